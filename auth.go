@@ -0,0 +1,52 @@
+package doh
+
+import (
+	"net/http"
+)
+
+// Auth holds the credentials used to authenticate requests to a DoH endpoint.
+// The credentials themselves are never exposed, and are redacted when the Auth
+// is printed.
+type Auth struct {
+	bearer   string
+	username string
+	password string
+	basic    bool
+}
+
+// BearerAuth returns an Auth which authenticates requests with the given
+// bearer token.
+func BearerAuth(token string) *Auth {
+	return &Auth{bearer: token}
+}
+
+// BasicAuth returns an Auth which authenticates requests using HTTP Basic
+// authentication with the given username and password.
+func BasicAuth(username, password string) *Auth {
+	return &Auth{username: username, password: password, basic: true}
+}
+
+// apply sets the Authorization header of the given request.
+func (a *Auth) apply(req *http.Request) {
+	if a.basic {
+		req.SetBasicAuth(a.username, a.password)
+		return
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.bearer)
+}
+
+// String implements fmt.Stringer, and never includes the credentials.
+func (a *Auth) String() string {
+	if a.basic {
+		return "Basic [REDACTED]"
+	}
+
+	return "Bearer [REDACTED]"
+}
+
+// GoString implements fmt.GoStringer, so that the credentials aren't printed
+// with the %#v verb either.
+func (a *Auth) GoString() string {
+	return a.String()
+}
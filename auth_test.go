@@ -0,0 +1,40 @@
+package doh
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		auth     *Auth
+		expected string
+	}{
+		{BearerAuth("s3cr3t"), "Bearer s3cr3t"},
+		// base64("brendan:s3cr3t")
+		{BasicAuth("brendan", "s3cr3t"), "Basic YnJlbmRhbjpzM2NyM3Q="},
+	}
+
+	for _, test := range tests {
+		var header string
+		r := newStubResolver(nil)
+		r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			header = req.Header.Get("Authorization")
+			return nil, fmt.Errorf("stop")
+		})
+		r.Auth = test.auth
+
+		r.LookupA("brendan.abolivier.bzh")
+		if header != test.expected {
+			t.Errorf("expected Authorization header %q, got %q", test.expected, header)
+		}
+
+		for _, s := range []string{fmt.Sprint(test.auth), fmt.Sprintf("%#v", test.auth), fmt.Sprintf("%+v", r)} {
+			if strings.Contains(s, "s3cr3t") {
+				t.Errorf("credentials leaked in %q", s)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package doh
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultBatchParallelism is the maximum number of lookups LookupBatch performs
+// concurrently if the resolver's BatchParallelism isn't set.
+const DefaultBatchParallelism = 8
+
+// BatchResult is the result of the lookup of one of the names given to
+// LookupBatch.
+type BatchResult struct {
+	// Name is the FQDN that was looked up.
+	Name string
+	// Records and TTLs are the records of the lookup, as returned by Lookup,
+	// such that TTLs[0] is the TTL for Records[0], and so on.
+	Records []Record
+	TTLs    []uint32
+	// Err is the error the lookup failed with, if any.
+	Err error
+}
+
+// LookupBatch performs concurrent DoH lookups on records of the given type for
+// each of the given FQDNs, bounded by the given context. At most
+// r.BatchParallelism lookups are in flight at the same time.
+// Returns one result per name, in the same order as names. Errors affecting a
+// single lookup are reported in its result.
+// Returns the context's error if it's done before all the lookups complete, in
+// which case the results of the lookups which didn't complete hold that error.
+func (r *Resolver) LookupBatch(ctx context.Context, names []string, t DNSType) ([]BatchResult, error) {
+	parallelism := r.BatchParallelism
+	if parallelism <= 0 {
+		parallelism = DefaultBatchParallelism
+	}
+
+	results := make([]BatchResult, len(names))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		results[i].Name = name
+
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(res *BatchResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res.Records, res.TTLs, res.Err = r.Lookup(ctx, res.Name, t)
+		}(&results[i])
+	}
+
+	wg.Wait()
+
+	return results, ctx.Err()
+}
@@ -0,0 +1,94 @@
+package doh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestLookupBatch(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	r := newStubResolver(func(q []byte) []byte {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		// Answer host<n>.abolivier.bzh with 192.0.2.<n>.
+		var n byte
+		fmt.Sscanf(string(q[DNSMsgHeaderLen+1:]), "host%d", &n)
+		return buildResponse(q, buildRR(A, 300, []byte{192, 0, 2, n}))
+	})
+	r.BatchParallelism = 2
+
+	names := make([]string, 10)
+	for i := range names {
+		names[i] = fmt.Sprintf("host%d.abolivier.bzh", i)
+	}
+	// An invalid name must only fail its own lookup.
+	names[5] = "invalid..abolivier.bzh"
+
+	results, err := r.LookupBatch(context.Background(), names, A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(names) {
+		t.FailNow()
+	}
+
+	for i, res := range results {
+		if res.Name != names[i] {
+			t.Errorf("unexpected name %s at index %d", res.Name, i)
+			continue
+		}
+
+		if i == 5 {
+			if res.Err != ErrInvalidName {
+				t.Errorf("unexpected error %v for %s", res.Err, res.Name)
+			}
+			continue
+		}
+
+		expected := fmt.Sprintf("192.0.2.%d", i)
+		if res.Err != nil || len(res.Records) != 1 || res.Records[0].(*ARecord).IP4 != expected {
+			t.Errorf("unexpected result %+v for %s", res, res.Name)
+		}
+	}
+
+	if maxInFlight > 2 {
+		t.Errorf("%d lookups in flight at once", maxInFlight)
+	}
+}
+
+func TestLookupBatchCanceled(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		t.Error("query sent with a canceled context")
+		return buildResponse(q)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	names := []string{"brendan.abolivier.bzh", "abolivier.bzh"}
+	results, err := r.LookupBatch(ctx, names, A)
+	if err != context.Canceled || len(results) != len(names) {
+		t.FailNow()
+	}
+
+	for _, res := range results {
+		if res.Err == nil {
+			t.Fail()
+		}
+	}
+}
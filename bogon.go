@@ -0,0 +1,88 @@
+package doh
+
+import (
+	"net"
+)
+
+// bogonNets lists the address ranges that aren't expected to be part of an
+// answer from the public DNS: private, shared, loopback, link-local,
+// documentation, benchmarking, multicast and reserved ranges.
+var bogonNets = parseCIDRs(
+	// IPv4
+	"0.0.0.0/8",       // "This" network (RFC 1122)
+	"10.0.0.0/8",      // Private-use (RFC 1918)
+	"100.64.0.0/10",   // Shared address space (RFC 6598)
+	"127.0.0.0/8",     // Loopback (RFC 1122)
+	"169.254.0.0/16",  // Link-local (RFC 3927)
+	"172.16.0.0/12",   // Private-use (RFC 1918)
+	"192.0.0.0/24",    // IETF protocol assignments (RFC 6890)
+	"192.0.2.0/24",    // Documentation, TEST-NET-1 (RFC 5737)
+	"192.168.0.0/16",  // Private-use (RFC 1918)
+	"198.18.0.0/15",   // Benchmarking (RFC 2544)
+	"198.51.100.0/24", // Documentation, TEST-NET-2 (RFC 5737)
+	"203.0.113.0/24",  // Documentation, TEST-NET-3 (RFC 5737)
+	"224.0.0.0/4",     // Multicast (RFC 5771)
+	"240.0.0.0/4",     // Reserved (RFC 1112), including broadcast
+	// IPv6
+	"::/128",        // Unspecified address (RFC 4291)
+	"::1/128",       // Loopback (RFC 4291)
+	"100::/64",      // Discard-only (RFC 6666)
+	"2001:db8::/32", // Documentation (RFC 3849)
+	"fc00::/7",      // Unique local (RFC 4193)
+	"fe80::/10",     // Link-local (RFC 4291)
+	"ff00::/8",      // Multicast (RFC 4291)
+)
+
+// parseCIDRs parses the given CIDR notations into networks, and panics if one
+// of them is invalid.
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isBogon returns true if the given IP address belongs to a range that isn't
+// expected to be part of an answer from the public DNS, or if it isn't a valid
+// IP address. IPv4-mapped IPv6 addresses are checked against the IPv4 ranges.
+func isBogon(ip net.IP) bool {
+	if ip == nil {
+		return true
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, n := range bogonNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasBogon returns true if one of the A or AAAA answers of the given message
+// has an address isBogon returns true for.
+func (m *message) hasBogon() bool {
+	for _, a := range m.answers {
+		switch rec := a.parsed.(type) {
+		case *ARecord:
+			if a.t == A && isBogon(rec.IP) {
+				return true
+			}
+		case *AAAARecord:
+			if a.t == AAAA && isBogon(rec.IP) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package doh
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsBogon(t *testing.T) {
+	bogons := []string{
+		"10.1.2.3",
+		"172.16.0.1",
+		"192.168.1.1",
+		"127.0.0.1",
+		"169.254.169.254",
+		"0.0.0.0",
+		"::1",
+		"fe80::1",
+		"fd00::1",
+		"::ffff:192.168.1.1",
+	}
+	for _, ip := range bogons {
+		if !isBogon(net.ParseIP(ip)) {
+			t.Errorf("%s should be a bogon", ip)
+		}
+	}
+
+	public := []string{
+		expectedA,
+		expectedAAAA,
+		"172.32.0.1",
+		"::ffff:51.38.47.191",
+	}
+	for _, ip := range public {
+		if isBogon(net.ParseIP(ip)) {
+			t.Errorf("%s shouldn't be a bogon", ip)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package doh
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// bootstrapTransport is a transport derived from the one of a resolver's HTTP
+// client in order to connect to its bootstrap address.
+type bootstrapTransport struct {
+	// base is the transport it's been derived from.
+	base *http.Transport
+	// addr is the bootstrap address it connects to.
+	addr string
+	// target is the address the dials it redirects to addr are for.
+	target    string
+	transport *http.Transport
+}
+
+// bootstrapClient returns a copy of the given HTTP client which connects to
+// r.BootstrapAddr instead of resolving the host of the given URL. The address
+// can be an IP address, in which case the port from the URL is used, or an IP
+// address and a port. The host of the URL is still used for the Host header
+// and the TLS server name, so that the server's certificate is validated
+// against it. Connections to other addresses, e.g. to a proxy, are dialed
+// as is, so that the proxy resolves the host instead.
+// The transport of the copy is kept by the resolver until the client's
+// transport or r.BootstrapAddr changes, so that lookups reuse its
+// connections.
+// Returns ErrBootstrapTransport if the client's transport (or
+// http.DefaultTransport if it's nil) isn't a *http.Transport.
+func (r *Resolver) bootstrapClient(client *http.Client, u *url.URL) (*http.Client, error) {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, ErrBootstrapTransport
+	}
+
+	target := dialAddress(u)
+
+	r.bootstrapMu.Lock()
+	b := r.bootstrap
+	if b == nil || b.base != t || b.addr != r.BootstrapAddr || b.target != target {
+		b = newBootstrapTransport(t, r.BootstrapAddr, target)
+		r.bootstrap = b
+	}
+	r.bootstrapMu.Unlock()
+
+	c := new(http.Client)
+	*c = *client
+	c.Transport = b.transport
+	return c, nil
+}
+
+// newBootstrapTransport returns a bootstrapTransport derived from the given
+// transport, which connects to the given bootstrap address instead of the
+// given target address.
+func newBootstrapTransport(base *http.Transport, addr, target string) *bootstrapTransport {
+	transport := base.Clone()
+
+	dial := transport.DialContext
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if strings.EqualFold(address, target) {
+			address = bootstrapAddress(addr, address)
+		}
+		return dial(ctx, network, address)
+	}
+
+	return &bootstrapTransport{base: base, addr: addr, target: target, transport: transport}
+}
+
+// dialAddress returns the address net/http dials in order to connect to the
+// host of the given HTTPS URL without a proxy.
+func dialAddress(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// bootstrapAddress returns the address to dial instead of the given one, given
+// a bootstrap address which is either an IP address or an IP address and a
+// port.
+func bootstrapAddress(bootstrap, address string) string {
+	if _, _, err := net.SplitHostPort(bootstrap); err == nil {
+		return bootstrap
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return bootstrap
+	}
+
+	return net.JoinHostPort(bootstrap, port)
+}
@@ -0,0 +1,169 @@
+package doh
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestBootstrapAddr(t *testing.T) {
+	var serverName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191})))
+	}))
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Record the addresses the client dials.
+	var dialed []string
+	client := server.Client()
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return new(net.Dialer).DialContext(ctx, network, address)
+	}
+
+	// The test server's certificate is valid for example.com, which must
+	// therefore never be resolved.
+	r := &Resolver{
+		Host:          "example.com:" + port,
+		Class:         IN,
+		HTTPClient:    client,
+		BootstrapAddr: "127.0.0.1",
+	}
+
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA {
+		t.Fail()
+	}
+
+	if len(dialed) != 1 || dialed[0] != "127.0.0.1:"+port {
+		t.Errorf("unexpected dialed addresses %v", dialed)
+	}
+
+	if serverName != "example.com" {
+		t.Errorf("unexpected TLS server name %q", serverName)
+	}
+}
+
+func TestBootstrapAddrUnsupportedTransport(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q)
+	})
+	r.BootstrapAddr = "127.0.0.1"
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrBootstrapTransport {
+		t.Fail()
+	}
+}
+
+func TestBootstrapDialsOnlyTarget(t *testing.T) {
+	var dialed []string
+	base := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			return nil, errors.New("not dialing")
+		},
+	}
+
+	b := newBootstrapTransport(base, "192.0.2.1", "dns.example.com:443")
+	for _, address := range []string{"DNS.example.com:443", "proxy.example.com:3128"} {
+		b.transport.DialContext(context.Background(), "tcp", address)
+	}
+
+	// Dials to a proxy aren't redirected to the bootstrap address.
+	if !reflect.DeepEqual(dialed, []string{"192.0.2.1:443", "proxy.example.com:3128"}) {
+		t.Errorf("unexpected dialed addresses %v", dialed)
+	}
+}
+
+func TestBootstrapClientReuse(t *testing.T) {
+	u, err := url.Parse("https://dns.example.com/dns-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{}}
+	r := &Resolver{Host: "dns.example.com", HTTPClient: client, BootstrapAddr: "192.0.2.1"}
+
+	first, err := r.bootstrapClient(client, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := r.bootstrapClient(client, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Transport != second.Transport {
+		t.Error("expected the transport to be reused")
+	}
+
+	// Changing the client's transport or the bootstrap address derives a new
+	// transport.
+	client.Transport = &http.Transport{}
+	third, err := r.bootstrapClient(client, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if third.Transport == second.Transport || r.bootstrap.base != client.Transport {
+		t.Error("expected a new transport for the new client transport")
+	}
+
+	r.BootstrapAddr = "192.0.2.2"
+	fourth, err := r.bootstrapClient(client, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fourth.Transport == third.Transport {
+		t.Error("expected a new transport for the new bootstrap address")
+	}
+}
+
+func TestBootstrapAddress(t *testing.T) {
+	tests := []struct {
+		bootstrap string
+		expected  string
+	}{
+		{"192.0.2.1", "192.0.2.1:443"},
+		{"2001:db8::1", "[2001:db8::1]:443"},
+		{"192.0.2.1:8443", "192.0.2.1:8443"},
+	}
+
+	for _, test := range tests {
+		if addr := bootstrapAddress(test.bootstrap, "dns.example.com:443"); addr != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.bootstrap, test.expected, addr)
+		}
+	}
+}
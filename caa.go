@@ -0,0 +1,116 @@
+package doh
+
+import (
+	"strings"
+)
+
+// caaCriticalFlag is the issuer critical flag of a CAA record's flags, as
+// described in section 4.1 of RFC 8659.
+const caaCriticalFlag = 1 << 7
+
+// Critical returns true if the issuer critical flag is set on the record,
+// meaning that a CA must not issue certificates for the domain if it doesn't
+// understand the record's property tag.
+func (c *CAARecord) Critical() bool {
+	return c.Flag&caaCriticalFlag != 0
+}
+
+// HasReservedFlags returns true if any of the flags other than the issuer
+// critical flag is set on the record. Section 4.1 of RFC 8659 reserves these
+// flags for future use, and requires them to be set to zero.
+func (c *CAARecord) HasReservedFlags() bool {
+	return c.Flag&^caaCriticalFlag != 0
+}
+
+// CAAParameter is a parameter of an "issue" or "issuewild" CAA record's value,
+// as described in section 4.2 of RFC 8659.
+type CAAParameter struct {
+	Tag   string
+	Value string
+}
+
+// Issuer parses the value of an "issue" or "issuewild" CAA record as described
+// in section 4.2 of RFC 8659, e.g. "letsencrypt.org; validationmethods=http-01".
+// Returns the domain name of the issuer, and its parameters in the order they
+// appear in the value. An empty domain name (e.g. a value of ";") means that no
+// certificate issuance is authorised.
+// Returns ErrCAANotIssuer if the record's tag isn't "issue" or "issuewild", and
+// ErrCAAMalformed if its value doesn't follow the syntax from the RFC.
+func (c *CAARecord) Issuer() (domain string, params []CAAParameter, err error) {
+	tag := strings.ToLower(c.Tag)
+	if tag != "issue" && tag != "issuewild" {
+		err = ErrCAANotIssuer
+		return
+	}
+
+	params = make([]CAAParameter, 0)
+
+	parts := strings.Split(c.Value, ";")
+	domain = trimWSP(parts[0])
+	if len(domain) > 0 {
+		for _, label := range strings.Split(domain, ".") {
+			if !isCAALabel(label) {
+				return "", nil, ErrCAAMalformed
+			}
+		}
+	}
+
+	for _, part := range parts[1:] {
+		part = trimWSP(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", nil, ErrCAAMalformed
+		}
+
+		param := CAAParameter{
+			Tag:   trimWSP(kv[0]),
+			Value: trimWSP(kv[1]),
+		}
+		if !isCAALabel(param.Tag) || !isCAAParamValue(param.Value) {
+			return "", nil, ErrCAAMalformed
+		}
+
+		params = append(params, param)
+	}
+
+	return
+}
+
+// trimWSP trims the spaces and horizontal tabs surrounding the given string.
+func trimWSP(s string) string {
+	return strings.Trim(s, " \t")
+}
+
+// isCAALabel checks that the given string matches the syntax of a label of an
+// issuer domain name, which is also the syntax of a parameter's tag, i.e.
+// (ALPHA / DIGIT) *( *("-") (ALPHA / DIGIT)).
+func isCAALabel(s string) bool {
+	if len(s) == 0 || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') &&
+			!(c >= '0' && c <= '9') && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isCAAParamValue checks that the given string matches the syntax of a
+// parameter's value, i.e. *(%x21-3A / %x3C-7E).
+func isCAAParamValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e || s[i] == ';' {
+			return false
+		}
+	}
+
+	return true
+}
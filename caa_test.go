@@ -0,0 +1,88 @@
+package doh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCAAIssuer(t *testing.T) {
+	rec := &CAARecord{Tag: "issue", Value: "letsencrypt.org"}
+	domain, params, err := rec.Issuer()
+	if err != nil || domain != "letsencrypt.org" || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestCAAIssuerParams(t *testing.T) {
+	rec := &CAARecord{
+		Tag:   "issuewild",
+		Value: "ca.example.net; account=230123 ; validationmethods=http-01",
+	}
+
+	domain, params, err := rec.Issuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if domain != "ca.example.net" {
+		t.Fail()
+	}
+
+	expected := []CAAParameter{
+		{Tag: "account", Value: "230123"},
+		{Tag: "validationmethods", Value: "http-01"},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Fail()
+	}
+}
+
+func TestCAAIssuerForbidden(t *testing.T) {
+	rec := &CAARecord{Tag: "issue", Value: ";"}
+	domain, params, err := rec.Issuer()
+	if err != nil || domain != "" || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestCAAIssuerErrors(t *testing.T) {
+	rec := &CAARecord{Tag: "iodef", Value: "mailto:security@example.com"}
+	if _, _, err := rec.Issuer(); err != ErrCAANotIssuer {
+		t.Fail()
+	}
+
+	malformed := []string{
+		"-ca.example.net",
+		"ca..example.net",
+		"ca.example.net; account",
+		"ca.example.net; account=23 0123",
+	}
+	for _, value := range malformed {
+		rec := &CAARecord{Tag: "issue", Value: value}
+		if _, _, err := rec.Issuer(); err != ErrCAAMalformed {
+			t.Errorf("expected %q to be malformed, got %v", value, err)
+		}
+	}
+}
+
+func TestCAAFlags(t *testing.T) {
+	rec := &CAARecord{Flag: 0, Tag: "issue", Value: "letsencrypt.org"}
+	if rec.Critical() || rec.HasReservedFlags() {
+		t.Fail()
+	}
+
+	rec.Flag = 128
+	if !rec.Critical() || rec.HasReservedFlags() {
+		t.Fail()
+	}
+
+	rec.Flag = 129
+	if !rec.Critical() || !rec.HasReservedFlags() {
+		t.Fail()
+	}
+
+	rec.Flag = 1
+	if rec.Critical() || !rec.HasReservedFlags() {
+		t.Fail()
+	}
+}
@@ -0,0 +1,215 @@
+package doh
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheKey identifies the lookups a cached message answers.
+type cacheKey struct {
+	fqdn     string
+	t        DNSType
+	c        DNSClass
+	validate bool
+	dnssecOK bool
+	// normalizeNames is whether the names of the message's records are
+	// normalized, which depends on the resolver that cached it.
+	normalizeNames bool
+	// ednsOptions holds the code and data of the EDNS options of the query
+	// (e.g. its Client Subnet), since the server can tailor its answers to
+	// them.
+	ednsOptions string
+}
+
+// cacheEntry is a message stored in a cache.
+type cacheEntry struct {
+	msg      *message
+	storedAt time.Time
+	expires  time.Time
+}
+
+// Cache is an in-memory cache of responses to lookups, which a resolver uses
+// if it's set as its Cache. Responses are cached until the lowest TTL of
+// their answers expires, and the TTLs of cached answers are decreased by the
+// time they've spent in the cache.
+// Only successful responses with at least one answer are cached.
+// Responses are cached separately for each client subnet the lookups are
+// performed for (see Resolver.ClientSubnet).
+// A Cache is safe for concurrent use, and can be shared by several resolvers
+// as long as they use the same host.
+type Cache struct {
+	mu         sync.Mutex
+	entries    map[cacheKey]*cacheEntry
+	maxEntries int
+	// now returns the current time. It is overridden in tests.
+	now func() time.Time
+}
+
+// NewCache returns an empty cache holding at most maxEntries responses. If
+// maxEntries is zero or negative, the number of responses isn't bounded.
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		entries:    make(map[cacheKey]*cacheEntry),
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// Len returns the number of responses in the cache, including the ones that
+// have expired but haven't been evicted yet.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// get returns a copy of the message cached for the given key, with TTLs
+// decreased by the time it's spent in the cache.
+// Returns false if there's no such message, or if it's expired.
+func (c *Cache) get(k cacheKey) (*message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+
+	now := c.now()
+	if !now.Before(e.expires) {
+		delete(c.entries, k)
+		return nil, false
+	}
+
+	elapsed := uint32(now.Sub(e.storedAt) / time.Second)
+	msg := &message{
+		header:     e.msg.header,
+		questions:  e.msg.questions,
+		answers:    decreaseTTLs(e.msg.answers, elapsed),
+		authority:  decreaseTTLs(e.msg.authority, elapsed),
+		additional: decreaseTTLs(e.msg.additional, elapsed),
+	}
+
+	return msg, true
+}
+
+// put caches the given message for the given key, until the lowest TTL of its
+// answers expires. If the cache is full, expired messages are evicted first,
+// and then the message closest to expiring.
+func (c *Cache) put(k cacheKey, msg *message) {
+	if len(msg.answers) == 0 {
+		return
+	}
+
+	minTTL := msg.answers[0].ttl
+	for _, a := range msg.answers[1:] {
+		if a.ttl < minTTL {
+			minTTL = a.ttl
+		}
+	}
+
+	if minTTL == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[k]; !ok && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+
+	c.entries[k] = &cacheEntry{
+		msg:      msg,
+		storedAt: now,
+		expires:  now.Add(time.Duration(minTTL) * time.Second),
+	}
+}
+
+// evict removes the expired messages from the cache, or the one closest to
+// expiring if none has. Must be called with c.mu held.
+func (c *Cache) evict(now time.Time) {
+	var soonest cacheKey
+	var soonestExpires time.Time
+	evicted := false
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+			evicted = true
+			continue
+		}
+
+		if soonestExpires.IsZero() || e.expires.Before(soonestExpires) {
+			soonest = k
+			soonestExpires = e.expires
+		}
+	}
+
+	if !evicted && !soonestExpires.IsZero() {
+		delete(c.entries, soonest)
+	}
+}
+
+// newCacheKey returns the key to cache responses to the given lookup with.
+// Names are case-insensitive, as described in section 2.3.3 of RFC 1035.
+func newCacheKey(fqdn string, t DNSType, c DNSClass, opts queryOptions) cacheKey {
+	var options strings.Builder
+	for _, o := range opts.ednsOptions {
+		options.WriteByte(byte(o.code >> 8))
+		options.WriteByte(byte(o.code))
+		options.WriteByte(byte(len(o.data) >> 8))
+		options.WriteByte(byte(len(o.data)))
+		options.Write(o.data)
+	}
+
+	return cacheKey{
+		fqdn:        strings.ToLower(strings.TrimSuffix(fqdn, ".")),
+		t:           t,
+		c:           c,
+		validate:    opts.validate,
+		dnssecOK:    opts.dnssecOK,
+		ednsOptions: options.String(),
+	}
+}
+
+// decreaseTTLs returns a copy of the given records, with their TTL decreased by
+// the given number of seconds.
+func decreaseTTLs(rrs []answer, elapsed uint32) []answer {
+	if rrs == nil {
+		return nil
+	}
+
+	decreased := make([]answer, len(rrs))
+	copy(decreased, rrs)
+	for i := range decreased {
+		if decreased[i].ttl > elapsed {
+			decreased[i].ttl -= elapsed
+		} else {
+			decreased[i].ttl = 0
+		}
+
+		// The TTL in the record's RRHeader must match the answer's, without
+		// changing the cached record.
+		decreased[i].parsed = copyRecord(decreased[i].parsed)
+		decreased[i].setRRHeader()
+	}
+
+	return decreased
+}
+
+// copyRecord returns a shallow copy of the given parsed record, which is a
+// pointer to one of the record types, or the record itself if it's nil.
+func copyRecord(rec Record) Record {
+	v := reflect.ValueOf(rec)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return rec
+	}
+
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	return c.Interface().(Record)
+}
@@ -0,0 +1,215 @@
+package doh
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCache returns a cache which clock can be moved forward with the
+// returned function.
+func newTestCache(maxEntries int) (*Cache, func(d time.Duration)) {
+	now := time.Unix(1600000000, 0)
+	c := NewCache(maxEntries)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestCache(t *testing.T) {
+	var queries int
+	r := newStubResolver(func(q []byte) []byte {
+		queries++
+		return buildResponse(
+			q,
+			buildRR(A, 300, []byte{51, 38, 47, 191}),
+			buildRR(A, 60, []byte{51, 38, 47, 192}),
+		)
+	})
+	cache, advance := newTestCache(0)
+	r.Cache = cache
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+		t.Fatal(err)
+	}
+
+	advance(10 * time.Second)
+
+	// Names are case-insensitive.
+	recs, ttls, err := r.LookupA("Brendan.Abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if queries != 1 {
+		t.Errorf("expected 1 query, got %d", queries)
+	}
+
+	if len(recs) != 2 || ttls[0] != 290 || ttls[1] != 50 {
+		t.Errorf("unexpected TTLs %v", ttls)
+	}
+
+	// The records' TTLs are decreased as well.
+	if recs[0].TTL != ttls[0] || recs[1].TTL != ttls[1] {
+		t.Errorf("unexpected record TTLs %d and %d", recs[0].TTL, recs[1].TTL)
+	}
+
+	// The lowest TTL has expired.
+	advance(50 * time.Second)
+
+	_, ttls, err = r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if queries != 2 || ttls[0] != 300 {
+		t.Errorf("unexpected queries %d and TTLs %v", queries, ttls)
+	}
+}
+
+func TestCacheOnlySuccess(t *testing.T) {
+	var queries int
+	r := newStubResolver(func(q []byte) []byte {
+		queries++
+		res := buildResponse(q)
+		// RCODE = 3 (name error)
+		res[3] |= 3
+		return res
+	})
+	r.Cache = NewCache(0)
+
+	for i := 0; i < 2; i++ {
+		r.LookupA("brendan.abolivier.bzh")
+	}
+
+	if queries != 2 || r.Cache.Len() != 0 {
+		t.Fail()
+	}
+}
+
+func TestCacheClientSubnet(t *testing.T) {
+	const name = "brendan.abolivier.bzh"
+	cache := NewCache(0)
+
+	var queries int
+	resolver := func(subnet string, addr []byte) *Resolver {
+		r := newStubResolver(func(q []byte) []byte {
+			queries++
+			// Answer without the query's OPT record.
+			question := make([]byte, DNSMsgHeaderLen+len(name)+2+4)
+			copy(question, q)
+			binary.BigEndian.PutUint16(question[10:12], 0)
+			return buildResponse(question, buildRR(A, 300, addr))
+		})
+		r.Cache = cache
+		_, r.ClientSubnet, _ = net.ParseCIDR(subnet)
+		return r
+	}
+
+	for _, r := range []*Resolver{
+		resolver("192.0.2.0/24", []byte{192, 0, 2, 1}),
+		resolver("198.51.100.0/24", []byte{198, 51, 100, 1}),
+	} {
+		recs, _, err := r.LookupA(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Each subnet gets the answer the server tailored to it.
+		if len(recs) != 1 || !r.ClientSubnet.Contains(recs[0].IP) {
+			t.Errorf("unexpected records %v for %s", recs, r.ClientSubnet)
+		}
+	}
+
+	if queries != 2 || cache.Len() != 2 {
+		t.Errorf("unexpected queries %d and entries %d", queries, cache.Len())
+	}
+}
+
+func TestLookupNoCache(t *testing.T) {
+	var queries int
+	r := newStubResolver(func(q []byte) []byte {
+		queries++
+		return buildResponse(q, buildRR(A, 300, []byte{192, 0, 2, byte(queries)}))
+	})
+	cache, advance := newTestCache(0)
+	r.Cache = cache
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+		t.Fatal(err)
+	}
+
+	advance(10 * time.Second)
+
+	// The server is queried even though the cached response is still valid.
+	recs, ttls, err := r.LookupNoCache(context.Background(), "brendan.abolivier.bzh", A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if queries != 2 || len(recs) != 1 || recs[0].(*ARecord).IP4 != "192.0.2.2" || ttls[0] != 300 {
+		t.Errorf("unexpected queries %d and records %v", queries, recs)
+	}
+
+	advance(10 * time.Second)
+
+	// The cache now holds the new response.
+	a, aTTLs, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if queries != 2 || len(a) != 1 || a[0].IP4 != "192.0.2.2" || aTTLs[0] != 290 {
+		t.Errorf("unexpected queries %d and records %v", queries, a)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		// Make every response expire at a different time.
+		return buildResponse(q, buildRR(A, uint32(len(q)), []byte{51, 38, 47, 191}))
+	})
+	cache, _ := newTestCache(2)
+	r.Cache = cache
+
+	for _, name := range []string{"a.abolivier.bzh", "bb.abolivier.bzh", "ccc.abolivier.bzh"} {
+		if _, _, err := r.LookupA(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cache.Len() != 2 {
+		t.FailNow()
+	}
+
+	// The response closest to expiring has been evicted.
+	if _, ok := cache.get(newCacheKey("a.abolivier.bzh", A, IN, queryOptions{})); ok {
+		t.Fail()
+	}
+
+	if _, ok := cache.get(newCacheKey("ccc.abolivier.bzh", A, IN, queryOptions{})); !ok {
+		t.Fail()
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+	r.Cache = NewCache(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := r.LookupA(fmt.Sprintf("%d.abolivier.bzh", i%3)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
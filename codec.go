@@ -0,0 +1,29 @@
+package doh
+
+// EncodeQuery returns a recursive DNS query in wire format for records of the
+// given type and class for the given FQDN, with a random ID, e.g. to send it
+// with a transport this package doesn't implement.
+// Returns ErrInvalidName if the FQDN isn't a valid domain name, or
+// ErrUnsupportedQueryType if t is AXFR or IXFR.
+func EncodeQuery(fqdn string, t DNSType, c DNSClass) ([]byte, error) {
+	if err := checkQueryType(t); err != nil {
+		return nil, err
+	}
+
+	return encodeQuery(fqdn, t, c, queryOptions{})
+}
+
+// ParseResponse parses the given DNS response in wire format, and returns the
+// records from its answer section, in the order the server sent them in. The
+// response isn't checked against any query.
+// Returns the same errors as lookups do when parsing responses, e.g.
+// ErrNotAResponse or ErrCorrupted. The answers are returned along with the
+// error if the response includes an error code, e.g. a *NXDomainError.
+func ParseResponse(raw []byte) ([]Answer, error) {
+	msg, err := parseResponse(raw, parseOptions{})
+	if msg == nil {
+		return nil, err
+	}
+
+	return exportAnswers(msg.answers), err
+}
@@ -0,0 +1,72 @@
+package doh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestEncodeQueryExported(t *testing.T) {
+	q, err := EncodeQuery("brendan.abolivier.bzh", A, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The known query has an ID of 0.
+	q[0], q[1] = 0, 0
+	if base64.RawURLEncoding.EncodeToString(q) != "AAABEAABAAAAAAAAB2JyZW5kYW4JYWJvbGl2aWVyA2J6aAAAAQAB" {
+		t.Errorf("unexpected query %x", q)
+	}
+
+	if _, err := EncodeQuery("brendan.abolivier.bzh", typeAXFR, IN); err != ErrUnsupportedQueryType {
+		t.Fail()
+	}
+}
+
+func TestParseResponseExported(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(validResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	answers, err := ParseResponse(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(answers) != validAnswersCount {
+		t.FailNow()
+	}
+
+	a := answers[len(answers)-1]
+	if a.Name != "aragog.brendanabolivier.com" || a.Type != A || a.Class != IN {
+		t.Errorf("unexpected answer %+v", a)
+	}
+
+	if rec, ok := a.Record.(*ARecord); !ok || rec.IP4 != expectedA || rec.TTL != a.TTL {
+		t.Fail()
+	}
+
+	// A query round-trips through ParseResponse once it's turned into a
+	// response.
+	q, err := EncodeQuery("brendan.abolivier.bzh", A, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers, err = ParseResponse(buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191})))
+	if err != nil || len(answers) != 1 || answers[0].Name != "brendan.abolivier.bzh" || answers[0].TTL != 300 {
+		t.Fail()
+	}
+
+	// Queries aren't responses.
+	if _, err := ParseResponse(q); err != ErrNotAResponse {
+		t.Fail()
+	}
+
+	binary.BigEndian.PutUint16(res[2:4], 0x8183)
+	if _, err := ParseResponse(res); !errors.Is(err, ErrNameError) {
+		t.Fail()
+	}
+}
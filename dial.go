@@ -0,0 +1,76 @@
+package doh
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// DialContext connects to the given address on the given network, resolving
+// the address' host with DoH lookups (see LookupIP) instead of the system's
+// resolver, and trying each of its addresses in order until a connection
+// succeeds. network must be one of "tcp", "tcp4", "tcp6", "udp", "udp4" or
+// "udp6", and address is of the form host:port.
+// It can be used as the DialContext function of an http.Transport, so that
+// HTTP requests resolve names through DoH, e.g.:
+//
+//	client := &http.Client{
+//		Transport: &http.Transport{DialContext: r.DialContext},
+//	}
+//
+// The resolver's own HTTP client must not use r.DialContext, since resolving
+// the resolver's host would then require a DoH lookup.
+// Returns an error if the lookups failed, if they didn't return any address
+// for the network, or the error from the last connection attempt if none
+// succeeded.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	// There's nothing to resolve if the host is an IP address.
+	if net.ParseIP(host) != nil {
+		return d.DialContext(ctx, network, address)
+	}
+
+	ips, _, err := r.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	err = &net.AddrError{Err: "no suitable address found", Addr: host}
+	for _, ip := range ips {
+		if !ipMatchesNetwork(ip, network) {
+			continue
+		}
+
+		var conn net.Conn
+		conn, err = d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// ipMatchesNetwork returns whether the given IP address can be used to connect
+// to the given network, i.e. whether its family matches the network's if the
+// network is restricted to one family (e.g. "tcp4").
+func ipMatchesNetwork(ip net.IP, network string) bool {
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return ip.To4() != nil
+	case strings.HasSuffix(network, "6"):
+		return ip.To4() == nil
+	}
+
+	return true
+}
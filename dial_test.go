@@ -0,0 +1,59 @@
+package doh
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestDialContext(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		close(accepted)
+	}()
+
+	r := newStubResolver(func(q []byte) []byte {
+		if DNSType(q[len(q)-3]) == A {
+			return buildResponse(q, buildRR(A, 300, []byte{127, 0, 0, 1}))
+		}
+		return buildResponse(q)
+	})
+
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	conn, err := r.DialContext(context.Background(), "tcp", net.JoinHostPort("brendan.abolivier.bzh", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if conn.RemoteAddr().String() != l.Addr().String() {
+		t.Errorf("connected to %s instead of %s", conn.RemoteAddr(), l.Addr())
+	}
+
+	<-accepted
+}
+
+func TestDialContextNoAddress(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		if DNSType(q[len(q)-3]) == A {
+			return buildResponse(q, buildRR(A, 300, []byte{127, 0, 0, 1}))
+		}
+		return buildResponse(q)
+	})
+
+	_, err := r.DialContext(context.Background(), "tcp6", "brendan.abolivier.bzh:443")
+	if _, ok := err.(*net.AddrError); !ok {
+		t.Fail()
+	}
+}
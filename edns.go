@@ -0,0 +1,193 @@
+package doh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+)
+
+// defaultEDNSPayloadSize is the UDP payload size advertised in the OPT record
+// of queries. Over DoH, it's only an indication for the server, and 1232 is the
+// value recommended by the DNS flag day 2020.
+const defaultEDNSPayloadSize = 1232
+
+// maxEDNSPayloadSize is the largest UDP payload size that can be advertised in
+// an OPT record.
+const maxEDNSPayloadSize = 65535
+
+// EDNS option codes, as listed in the IANA registry of EDNS0 option codes.
+const (
+	ednsOptionECS     = 8
+	ednsOptionPadding = 12
+)
+
+// paddingBlockSize is the size queries are padded to a multiple of, as
+// recommended by section 4.1 of RFC 8467.
+const paddingBlockSize = 128
+
+// ECS address families, as described in section 6 of RFC 7871.
+const (
+	ecsFamilyIPv4 = 1
+	ecsFamilyIPv6 = 2
+)
+
+// ednsOption is an option of an OPT record.
+type ednsOption struct {
+	code uint16
+	data []byte
+}
+
+// ecsOption returns the EDNS Client Subnet option describing the given subnet,
+// as described in section 6 of RFC 7871. The bits of the address beyond the
+// subnet's prefix length are zeroed.
+// Returns ErrInvalidSubnet if the subnet is neither a valid IPv4 nor IPv6
+// subnet.
+func ecsOption(subnet *net.IPNet) (ednsOption, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                    FAMILY                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|  SOURCE PREFIX-LENGTH |  SCOPE PREFIX-LENGTH  |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                    ADDRESS                    /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	ones, bits := subnet.Mask.Size()
+
+	var family uint16
+	var ip net.IP
+	switch {
+	case bits == 8*net.IPv4len && subnet.IP.To4() != nil:
+		family = ecsFamilyIPv4
+		ip = subnet.IP.To4()
+	case bits == 8*net.IPv6len && len(subnet.IP) == net.IPv6len:
+		family = ecsFamilyIPv6
+		ip = subnet.IP
+	default:
+		return ednsOption{}, ErrInvalidSubnet
+	}
+
+	// Only send the bytes covered by the prefix, with the bits beyond the
+	// prefix set to zero.
+	ip = ip.Mask(subnet.Mask)
+	addr := ip[:(ones+7)/8]
+
+	data := make([]byte, 4, 4+len(addr))
+	binary.BigEndian.PutUint16(data[0:2], family)
+	data[2] = byte(ones)
+	// SCOPE PREFIX-LENGTH = 0
+	data[3] = 0
+	data = append(data, addr...)
+
+	return ednsOption{code: ednsOptionECS, data: data}, nil
+}
+
+// paddingOption returns the EDNS Padding option, as described in RFC 7830,
+// which makes a message of the given length that ends with an OPT record
+// holding the given options and the padding option a multiple of
+// paddingBlockSize long.
+func paddingOption(msgLen int, options []ednsOption) ednsOption {
+	// The OPT record without any option is 11 bytes long.
+	unpadded := msgLen + 11
+	for _, o := range options {
+		unpadded += 4 + len(o.data)
+	}
+	// Include the padding option's code and length.
+	unpadded += 4
+
+	padLen := (paddingBlockSize - unpadded%paddingBlockSize) % paddingBlockSize
+	return ednsOption{code: ednsOptionPadding, data: make([]byte, padLen)}
+}
+
+// writeOPT writes an OPT record advertising the given UDP payload size and
+// holding the given options to the given buffer, as described in section 6.1
+// of RFC 6891. If dnssecOK is true, the record's DO bit is set, as described in
+// section 3 of RFC 3225.
+func writeOPT(b *bytes.Buffer, payloadSize uint16, dnssecOK bool, options []ednsOption) {
+	/*
+		+------------+--------------+------------------------------+
+		| Field Name | Field Type   | Description                  |
+		+------------+--------------+------------------------------+
+		| NAME       | domain name  | MUST be 0 (root domain)      |
+		| TYPE       | u_int16_t    | OPT (41)                     |
+		| CLASS      | u_int16_t    | requestor's UDP payload size |
+		| TTL        | u_int32_t    | extended RCODE and flags     |
+		| RDLEN      | u_int16_t    | length of all RDATA          |
+		| RDATA      | octet stream | {attribute,value} pairs      |
+		+------------+--------------+------------------------------+
+	*/
+	rdata := bytes.NewBuffer(nil)
+	for _, o := range options {
+		binary.Write(rdata, binary.BigEndian, o.code)
+		binary.Write(rdata, binary.BigEndian, uint16(len(o.data)))
+		rdata.Write(o.data)
+	}
+
+	// NAME = 0 (root domain)
+	b.WriteByte(0)
+	binary.Write(b, binary.BigEndian, uint16(OPT))
+	binary.Write(b, binary.BigEndian, payloadSize)
+	// Extended RCODE = 0, VERSION = 0, DO = 0 or 1
+	flags := []byte{0, 0, 0, 0}
+	if dnssecOK {
+		flags[2] = 1 << 7
+	}
+	b.Write(flags)
+	binary.Write(b, binary.BigEndian, uint16(rdata.Len()))
+	b.Write(rdata.Bytes())
+}
+
+// parseOPT parses the OPT record with the given CLASS, TTL and RDATA, as
+// described in section 6.1 of RFC 6891. Unlike other records, the CLASS and
+// TTL fields of OPT records hold the sender's UDP payload size and the
+// extended RCODE and flags of the message.
+// Returns ErrCorrupted if an option overflows the RDATA.
+func parseOPT(class DNSClass, ttl uint32, rdata []byte) (*OPTRecord, error) {
+	/*
+		TTL
+
+		            +0 (MSB)                            +1 (LSB)
+		   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+		0: |         EXTENDED-RCODE        |            VERSION            |
+		   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+		2: | DO|                           Z                               |
+		   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+
+		RDATA (for each option)
+
+		            +0 (MSB)                            +1 (LSB)
+		   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+		0: |                          OPTION-CODE                          |
+		   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+		2: |                         OPTION-LENGTH                         |
+		   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+		4: |                                                               |
+		   /                          OPTION-DATA                          /
+		   /                                                               /
+		   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+	*/
+	opt := new(OPTRecord)
+	opt.UDPSize = uint16(class)
+	opt.ExtendedRCode = uint8(ttl >> 24)
+	opt.Version = uint8(ttl >> 16)
+	opt.DNSSECOK = ttl>>15&1 == 1
+
+	for len(rdata) > 0 {
+		if len(rdata) < 4 {
+			return nil, ErrCorrupted
+		}
+
+		code := binary.BigEndian.Uint16(rdata[0:2])
+		length := int(binary.BigEndian.Uint16(rdata[2:4]))
+		if len(rdata) < 4+length {
+			return nil, ErrCorrupted
+		}
+
+		opt.Options = append(opt.Options, EDNSOption{Code: code, Data: rdata[4 : 4+length]})
+		rdata = rdata[4+length:]
+	}
+
+	return opt, nil
+}
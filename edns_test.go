@@ -0,0 +1,127 @@
+package doh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestECSOption(t *testing.T) {
+	subnets := map[string][]byte{
+		"192.0.2.0/24": {0, 1, 24, 0, 192, 0, 2},
+		// Bits beyond the prefix are zeroed.
+		"192.0.2.77/20": {0, 1, 20, 0, 192, 0, 0},
+		"0.0.0.0/0":     {0, 1, 0, 0},
+		"2001:db8:abcd:12ff::1/56": {
+			0, 2, 56, 0, 0x20, 0x01, 0x0d, 0xb8, 0xab, 0xcd, 0x12,
+		},
+	}
+
+	for cidr, expected := range subnets {
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// ParseCIDR already masks the address, so put it back.
+		subnet.IP = net.ParseIP(cidr[:bytes.IndexByte([]byte(cidr), '/')])
+
+		o, err := ecsOption(subnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if o.code != ednsOptionECS || !bytes.Equal(o.data, expected) {
+			t.Errorf("unexpected option data %v for %s", o.data, cidr)
+		}
+	}
+
+	invalid := &net.IPNet{IP: net.IP{192, 0, 2, 0}, Mask: net.CIDRMask(64, 128)}
+	if _, err := ecsOption(invalid); err != ErrInvalidSubnet {
+		t.Fail()
+	}
+}
+
+func TestLookupClientSubnet(t *testing.T) {
+	var additional []byte
+	r := newStubResolver(func(q []byte) []byte {
+		question := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+		if binary.BigEndian.Uint16(q[10:12]) != 1 {
+			t.Error("query doesn't have any additional record")
+		}
+
+		// Answer without the OPT record.
+		additional = q[len(question):]
+		res := buildResponse(q[:len(question)], buildRR(A, 300, []byte{51, 38, 47, 191}))
+		binary.BigEndian.PutUint16(res[10:12], 0)
+		return res
+	})
+	_, r.ClientSubnet, _ = net.ParseCIDR("192.0.2.0/24")
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		// NAME = root, TYPE = OPT, CLASS = payload size
+		0, 0, 41, 0x04, 0xd0,
+		// TTL = 0, RDLEN = 11
+		0, 0, 0, 0, 0, 11,
+		// OPTION-CODE = 8, OPTION-LENGTH = 7
+		0, 8, 0, 7,
+		// FAMILY = 1, SOURCE PREFIX-LENGTH = 24, SCOPE PREFIX-LENGTH = 0
+		0, 1, 24, 0,
+		// ADDRESS
+		192, 0, 2,
+	}
+	if !bytes.Equal(additional, expected) {
+		t.Errorf("unexpected OPT record %v", additional)
+	}
+}
+
+func TestEncodeQueryPadding(t *testing.T) {
+	long := "a-very-long-label-to-make-sure.the-query-doesnt-fit-in-a-single-block." +
+		"another-quite-long-label-to-add-even-more-bytes.abolivier.bzh"
+
+	for _, fqdn := range []string{"brendan.abolivier.bzh", long} {
+		q := mustEncodeQuery(fqdn, A, IN, queryOptions{pad: true})
+		if len(q)%paddingBlockSize != 0 {
+			t.Errorf("unexpected length %d for %s", len(q), fqdn)
+		}
+
+		if binary.BigEndian.Uint16(q[10:12]) != 1 {
+			t.Fail()
+		}
+	}
+
+	if len(mustEncodeQuery(long, A, IN, queryOptions{pad: true})) != 2*paddingBlockSize {
+		t.Fail()
+	}
+
+	// Padding composes with other options.
+	_, subnet, _ := net.ParseCIDR("192.0.2.0/24")
+	ecs, err := ecsOption(subnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{ednsOptions: []ednsOption{ecs}, pad: true})
+	if len(q) != paddingBlockSize {
+		t.Errorf("unexpected length %d", len(q))
+	}
+}
+
+func TestEncodeQueryDNSSECOK(t *testing.T) {
+	question := mustEncodeQuery("brendan.abolivier.bzh", DNSKEY, IN, queryOptions{})
+	q := mustEncodeQuery("brendan.abolivier.bzh", DNSKEY, IN, queryOptions{dnssecOK: true})
+
+	expected := []byte{
+		// NAME = root, TYPE = OPT, CLASS = payload size
+		0, 0, 41, 0x04, 0xd0,
+		// Extended RCODE = 0, VERSION = 0, DO = 1, RDLEN = 0
+		0, 0, 0x80, 0, 0, 0,
+	}
+	if binary.BigEndian.Uint16(q[10:12]) != 1 || !bytes.Equal(q[len(question):], expected) {
+		t.Errorf("unexpected OPT record %v", q[len(question):])
+	}
+}
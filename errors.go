@@ -2,6 +2,9 @@ package doh
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 // ErrFormatError means that the name server was unable to interpret the query.
@@ -26,6 +29,9 @@ var ErrNotImplemented = errors.New("Not implemented")
 // data.
 var ErrRefused = errors.New("Refused")
 
+// rcodeNameError is the response code for name errors.
+const rcodeNameError = 3
+
 var dnsErrors = []error{
 	nil,
 	ErrFormatError,
@@ -35,6 +41,68 @@ var dnsErrors = []error{
 	ErrRefused,
 }
 
+// rcodeNames maps the response codes listed in section 2.3 of RFC 6895 to their
+// mnemonic.
+var rcodeNames = map[int]string{
+	0:  "NOERROR",
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+	11: "DSOTYPENI",
+	16: "BADVERS",
+	17: "BADKEY",
+	18: "BADTIME",
+	19: "BADMODE",
+	20: "BADNAME",
+	21: "BADALG",
+	22: "BADTRUNC",
+	23: "BADCOOKIE",
+}
+
+// RCodeError means that the server responded with a non-zero response code.
+// The errors for the codes defined in RFC 1035 (1 to 5) can be matched against
+// ErrFormatError, ErrServerFailure, ErrNameError, ErrNotImplemented and
+// ErrRefused with errors.Is.
+type RCodeError struct {
+	// The response code.
+	Code int
+}
+
+// Name returns the mnemonic of the response code, e.g. "NXDOMAIN", or
+// "RCODE" followed by the code if it isn't known.
+func (e *RCodeError) Name() string {
+	if name, ok := rcodeNames[e.Code]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("RCODE%d", e.Code)
+}
+
+// Error implements error.
+func (e *RCodeError) Error() string {
+	if err := e.Unwrap(); err != nil {
+		return err.Error()
+	}
+
+	return fmt.Sprintf("the server responded with error code %d (%s)", e.Code, e.Name())
+}
+
+// Unwrap returns the sentinel error matching the response code, if any.
+func (e *RCodeError) Unwrap() error {
+	if e.Code > 0 && e.Code < len(dnsErrors) {
+		return dnsErrors[e.Code]
+	}
+
+	return nil
+}
+
 // ErrNotAResponse means that the server responded with a message that isn't a
 // response.
 var ErrNotAResponse = errors.New("the message the server sent us isn't a response")
@@ -43,6 +111,10 @@ var ErrNotAResponse = errors.New("the message the server sent us isn't a respons
 // (e.g. A, AAAA).
 var ErrNotIN = errors.New("class must be IN (Internet) (or ANYCLASS (*), which includes IN)")
 
+// ErrJSONClass means that the resolver uses the JSON format, but the lookup is
+// performed with a class other than IN, which DoH JSON APIs don't support.
+var ErrJSONClass = errors.New("the JSON format only supports the IN class")
+
 // ErrNotStandardQuery means that the server responded with an OPCODE header
 // that isn't a standard query, which is the only value currently supported.
 var ErrNotStandardQuery = errors.New("only standard queries are supported")
@@ -54,3 +126,342 @@ var ErrTruncated = errors.New("truncated messages aren't supported")
 // ErrCorrupted means that the message sent back by the server is either empty,
 // incomplete, or corrupted.
 var ErrCorrupted = errors.New("the message the server sent is empty, incomplete, or corrupted")
+
+// ErrPrivateAddr means that an answer contains a private, loopback, link-local
+// or otherwise reserved address, which the resolver is configured to reject.
+var ErrPrivateAddr = errors.New("the answer contains a private or reserved address")
+
+// ErrCAANotIssuer means that the property of a CAA record isn't "issue" or
+// "issuewild", so its value can't be parsed as an issuer.
+var ErrCAANotIssuer = errors.New("the CAA record's property isn't issue or issuewild")
+
+// ErrCAAMalformed means that the value of an "issue" or "issuewild" CAA record
+// doesn't follow the syntax described in section 4.2 of RFC 8659.
+var ErrCAAMalformed = errors.New("the CAA record's issuer value is malformed")
+
+// AnswerError describes an answer from a response that couldn't be parsed.
+type AnswerError struct {
+	// Index is the position of the answer in the response's answer section.
+	Index int
+	// Err is the reason why the answer couldn't be parsed.
+	Err error
+}
+
+func (e *AnswerError) Error() string {
+	return fmt.Sprintf("answer %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the reason why the answer couldn't be parsed.
+func (e *AnswerError) Unwrap() error {
+	return e.Err
+}
+
+// AnswerErrors is returned by the lookups of a resolver in best-effort mode
+// when some of the answers from the response couldn't be parsed. In this case,
+// the records returned by the lookup are the ones that could be parsed.
+type AnswerErrors []*AnswerError
+
+func (e AnswerErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d answer(s) couldn't be parsed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// ErrNoData means that the server responded successfully, but without any
+// answer for the name and type that were looked up.
+var ErrNoData = errors.New("the server didn't return any answer")
+
+// NoDataError is returned by the lookups of a resolver with ReportNoData set
+// when the server responds successfully but without any answer of the type
+// that was looked up, which is referred to as NODATA in RFC 2308.
+// errors.Is(err, ErrNoData) is true for any NoDataError.
+type NoDataError struct {
+	// SOA is the SOA record from the response's authority section, or nil if
+	// the response doesn't include one.
+	SOA *SOARecord
+	// TTL is, if SOA isn't nil, the time in seconds the absence of answer can
+	// be cached for, as described in section 5 of RFC 2308, i.e. the minimum
+	// between the TTL of the SOA record and its MINIMUM field.
+	TTL uint32
+}
+
+// newNoDataError creates a NoDataError out of the authority section of the
+// given message.
+func newNoDataError(msg *message) *NoDataError {
+	e := new(NoDataError)
+	e.SOA, e.TTL = negativeTTL(msg)
+	return e
+}
+
+// negativeTTL returns the SOA record from the authority section of the given
+// message, and the time in seconds a negative answer can be cached for
+// according to it, as described in section 5 of RFC 2308.
+// Returns a nil record if the message doesn't include a SOA record.
+func negativeTTL(msg *message) (soa *SOARecord, ttl uint32) {
+	for _, a := range msg.authority {
+		if s, ok := a.parsed.(*SOARecord); ok && a.t == SOA {
+			soa = s
+			ttl = a.ttl
+			if soa.Minimum < ttl {
+				ttl = soa.Minimum
+			}
+			return
+		}
+	}
+	return nil, 0
+}
+
+func (e *NoDataError) Error() string {
+	if e.SOA == nil {
+		return ErrNoData.Error()
+	}
+	return fmt.Sprintf("%s (negative TTL %d)", ErrNoData.Error(), e.TTL)
+}
+
+// Unwrap returns ErrNoData.
+func (e *NoDataError) Unwrap() error {
+	return ErrNoData
+}
+
+// NXDomainError is returned when the server responds with a name error (i.e.
+// NXDOMAIN), meaning that the name that was looked up doesn't exist.
+// errors.Is(err, ErrNameError) is true for any NXDomainError, and errors.As can
+// retrieve the *RCodeError it wraps.
+type NXDomainError struct {
+	// SOA is the SOA record from the response's authority section, or nil if
+	// the response doesn't include one.
+	SOA *SOARecord
+	// TTL is, if SOA isn't nil, the time in seconds the name error can be
+	// cached for, as described in section 5 of RFC 2308, i.e. the minimum
+	// between the TTL of the SOA record and its MINIMUM field.
+	TTL uint32
+}
+
+// newNXDomainError creates a NXDomainError out of the authority section of
+// the given message.
+func newNXDomainError(msg *message) *NXDomainError {
+	e := new(NXDomainError)
+	e.SOA, e.TTL = negativeTTL(msg)
+	return e
+}
+
+func (e *NXDomainError) Error() string {
+	if e.SOA == nil {
+		return ErrNameError.Error()
+	}
+	return fmt.Sprintf("%s (negative TTL %d)", ErrNameError.Error(), e.TTL)
+}
+
+// Unwrap returns the *RCodeError for a name error.
+func (e *NXDomainError) Unwrap() error {
+	return &RCodeError{Code: rcodeNameError}
+}
+
+// ErrInvalidAddr means that the IP address a reverse lookup has been requested
+// for is invalid.
+var ErrInvalidAddr = errors.New("invalid IP address")
+
+// ErrNoResolver means that a lookup has been requested from a MultiResolver
+// which doesn't have any resolver.
+var ErrNoResolver = errors.New("no resolver to perform the lookup with")
+
+// ErrTSIGAlgorithm means that the TSIG algorithm the resolver is configured
+// with isn't supported.
+var ErrTSIGAlgorithm = errors.New("unsupported TSIG algorithm")
+
+// ErrTSIGUnsigned means that the resolver is configured to use TSIG, but the
+// server's response isn't signed.
+var ErrTSIGUnsigned = errors.New("the response isn't signed with TSIG")
+
+// ErrTSIGBadKey means that the server's response is signed with another TSIG
+// key than the resolver's, or that the server doesn't know the resolver's key.
+var ErrTSIGBadKey = errors.New("TSIG key mismatch")
+
+// ErrTSIGBadSig means that the TSIG signature of the server's response is
+// invalid, or that the server couldn't verify the signature of the query.
+var ErrTSIGBadSig = errors.New("invalid TSIG signature")
+
+// ErrTSIGBadTime means that the server's response has been signed outside of
+// the allowed time window, or that the server considers the query has been.
+var ErrTSIGBadTime = errors.New("TSIG signature outside of the allowed time window")
+
+// ErrMethod means that the HTTP method the resolver is configured with isn't
+// supported, i.e. is neither POST nor GET.
+var ErrMethod = errors.New("unsupported HTTP method")
+
+// ErrNoHost means that the resolver doesn't have any host to send its DoH
+// requests to, nor any Exchanger to send its queries with.
+var ErrNoHost = errors.New("no DoH host configured")
+
+// ErrIDMismatch means that the ID of the response isn't the one of the query it
+// was sent in response to.
+var ErrIDMismatch = errors.New("the response's ID doesn't match the query's")
+
+// ErrInvalidURL means that the host and path the resolver is configured with
+// don't form a valid URL.
+var ErrInvalidURL = errors.New("invalid DoH URL")
+
+// ErrInvalidMediaType means that a media type the resolver is configured with
+// (i.e. its Accept or ContentType) isn't a valid media type.
+var ErrInvalidMediaType = errors.New("invalid media type")
+
+// ErrInvalidSubnet means that the client subnet the resolver is configured with
+// is neither a valid IPv4 nor IPv6 subnet.
+var ErrInvalidSubnet = errors.New("invalid client subnet")
+
+// ErrInvalidName means that a domain name can't be encoded, because one of its
+// labels is empty or longer than 63 octets, or because it's longer than 255
+// octets.
+var ErrInvalidName = errors.New("invalid domain name")
+
+// IPLookupError is returned by LookupIP when both the A and AAAA lookups fail.
+// errors.Is and errors.As match it against the errors of both lookups.
+type IPLookupError struct {
+	// AErr is the error the A lookup failed with.
+	AErr error
+	// AAAAErr is the error the AAAA lookup failed with.
+	AAAAErr error
+}
+
+func (e *IPLookupError) Error() string {
+	return fmt.Sprintf("A lookup failed: %s; AAAA lookup failed: %s", e.AErr.Error(), e.AAAAErr.Error())
+}
+
+// Is returns whether the error the A lookup or the AAAA lookup failed with
+// matches the given error.
+func (e *IPLookupError) Is(target error) bool {
+	return errors.Is(e.AErr, target) || errors.Is(e.AAAAErr, target)
+}
+
+// As finds the first error the lookups failed with, starting with the A
+// lookup, that matches the given target, and if one is found, sets the target
+// to that error.
+func (e *IPLookupError) As(target interface{}) bool {
+	return errors.As(e.AErr, target) || errors.As(e.AAAAErr, target)
+}
+
+// HTTPError means that the DoH server responded with a HTTP status code other
+// than 200.
+type HTTPError struct {
+	// The HTTP status code of the response.
+	StatusCode int
+	// The HTTP status of the response, e.g. "429 Too Many Requests".
+	Status string
+	// Body holds the start of the response's body, which some servers use to
+	// give details about the error. It's at most maxHTTPErrorBodyLen long.
+	Body []byte
+	// RetryAfter is, for 429 and 503 responses, the time to wait for before
+	// sending another request, as indicated by their Retry-After header. It's
+	// zero if the response doesn't include a valid Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("HTTPS server returned with non-OK code %d", e.StatusCode)
+	if e.Status != "" {
+		msg = fmt.Sprintf("HTTPS server returned with non-OK status %q", e.Status)
+	}
+
+	if body := strings.TrimSpace(string(e.Body)); body != "" {
+		msg += ": " + body
+	}
+
+	return msg
+}
+
+// ResolverError describes the error a lookup failed with when performed with
+// one of the resolvers of a MultiResolver.
+type ResolverError struct {
+	// Host is the host of the resolver the lookup was performed with.
+	Host string
+	// Err is the error the lookup failed with.
+	Err error
+}
+
+func (e *ResolverError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Host, e.Err.Error())
+}
+
+// Unwrap returns the error the lookup failed with.
+func (e *ResolverError) Unwrap() error {
+	return e.Err
+}
+
+// ResolverErrors is returned by the lookups of a MultiResolver when they
+// failed with every resolver, and holds the error they failed with for each of
+// them, in order. errors.Is and errors.As match it against each of these
+// errors.
+type ResolverErrors []*ResolverError
+
+func (e ResolverErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("lookup failed with %d resolver(s): %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Is returns whether the error one of the lookups failed with matches the
+// given error, e.g. so that errors.Is(err, ErrNameError) is true if a resolver
+// reported that the name doesn't exist.
+func (e ResolverErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error the lookups failed with that matches the given
+// target, and if one is found, sets the target to that error.
+func (e ResolverErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrBootstrapTransport means that a resolver has a bootstrap address, but its
+// HTTP client's transport isn't a *http.Transport, so it can't be made to
+// connect to that address.
+var ErrBootstrapTransport = errors.New("the HTTP client's transport doesn't support bootstrap addresses")
+
+// ErrUnexpectedContentType means that the DoH server responded with a media
+// type other than the one expected for the resolver's format, e.g. because the
+// response comes from a captive portal.
+var ErrUnexpectedContentType = errors.New("unexpected content type in response")
+
+// ErrCNAMEChainTooLong means that following the CNAME records of a name took
+// more than maxCNAMEDepth lookups, e.g. because the records form a loop.
+var ErrCNAMEChainTooLong = errors.New("CNAME chain too long")
+
+// ErrCaseMismatch means that the resolver randomizes the case of the names it
+// looks up, and that the response's question doesn't hold the name with the
+// same case as the query's, which suggests the response has been forged.
+var ErrCaseMismatch = errors.New("the case of the response's question doesn't match the query's")
+
+// ErrQuestionMismatch means that the question of the response isn't the one
+// of the query it was sent in response to, e.g. because it's the response to
+// another query.
+var ErrQuestionMismatch = errors.New("the response's question doesn't match the query's")
+
+// ErrUnsupportedQueryType means that the type the lookup has been requested
+// for can't be looked up over DoH, i.e. that it's a zone transfer (AXFR or
+// IXFR).
+var ErrUnsupportedQueryType = errors.New("zone transfers (AXFR and IXFR) aren't supported over DoH")
+
+// ErrNoService means that the domain explicitly states that the service which
+// SRV records have been looked up isn't available, with a single SRV record
+// which target is ".", as described in RFC 2782.
+var ErrNoService = errors.New("the service is decidedly not available at this domain")
+
+// ErrNotAuthenticated means that the resolver requires answers to be validated
+// using DNSSEC, and that the server didn't set the AD bit in its response.
+var ErrNotAuthenticated = errors.New("the server didn't report the answers as authenticated")
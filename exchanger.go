@@ -0,0 +1,33 @@
+package doh
+
+import (
+	"context"
+)
+
+// Exchanger sends DNS queries and returns the responses to them, both in the
+// wire format described in section 4 of RFC 1035. Setting one as the Exchanger
+// of a resolver makes it send its queries with it instead of over HTTPS, e.g.
+// to use another transport, or to answer queries with canned responses in
+// tests.
+type Exchanger interface {
+	// Exchange sends the given query, bounded by the given context, and
+	// returns the response to it.
+	Exchange(ctx context.Context, query []byte) ([]byte, error)
+}
+
+// exchangeQuery sends the given query with r.Exchanger, bounded by the given
+// context and by r.QueryTimeout if it's set, or using DoH if r.Exchanger isn't
+// set, and returns the response to it.
+func (r *Resolver) exchangeQuery(ctx context.Context, q []byte) ([]byte, error) {
+	if r.Exchanger == nil {
+		return r.exchangeHTTPS(ctx, q)
+	}
+
+	if r.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.QueryTimeout)
+		defer cancel()
+	}
+
+	return r.Exchanger.Exchange(ctx, q)
+}
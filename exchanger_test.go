@@ -0,0 +1,40 @@
+package doh
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+)
+
+// exchangerFunc is an Exchanger which sends queries with a function.
+type exchangerFunc func(ctx context.Context, q []byte) ([]byte, error)
+
+func (f exchangerFunc) Exchange(ctx context.Context, q []byte) ([]byte, error) {
+	return f(ctx, q)
+}
+
+func TestExchanger(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(validResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// No host is needed with an Exchanger.
+	r := &Resolver{
+		Class: IN,
+		Exchanger: exchangerFunc(func(_ context.Context, q []byte) ([]byte, error) {
+			// Give the canned response the query's ID.
+			copy(res[0:2], q[0:2])
+			return res, nil
+		}),
+	}
+
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != validACount || recs[0].IP4 != expectedA {
+		t.Fail()
+	}
+}
@@ -0,0 +1,110 @@
+package doh
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// maxCNAMEDepth is the maximum number of lookups LookupAFollow and
+// LookupAAAAFollow perform on the targets of CNAME records before giving up.
+const maxCNAMEDepth = 8
+
+// LookupAFollow performs a DoH lookup on A records for the given FQDN, bounded
+// by the given context. If the response only holds CNAME records, the lookup is
+// performed again on the end of the CNAME chain, until A records are found.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on,
+// along with the names of the chain, starting with fqdn and ending with the
+// name the records belong to.
+// Returns the same errors as LookupACtx, or ErrCNAMEChainTooLong if no A
+// record has been found after maxCNAMEDepth additional lookups.
+func (r *Resolver) LookupAFollow(ctx context.Context, fqdn string) (recs []*ARecord, ttls []uint32, chain []string, err error) {
+	chain, err = r.followCNAMEs(fqdn, func(name string) (msg *message, found bool, err error) {
+		recs, ttls, msg, err = r.lookupA(ctx, name, queryOptions{})
+		return msg, len(recs) > 0, err
+	})
+	return
+}
+
+// LookupAAAAFollow performs a DoH lookup on AAAA records for the given FQDN,
+// bounded by the given context. If the response only holds CNAME records, the
+// lookup is performed again on the end of the CNAME chain, until AAAA records
+// are found.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on,
+// along with the names of the chain, starting with fqdn and ending with the
+// name the records belong to.
+// Returns the same errors as LookupAAAACtx, or ErrCNAMEChainTooLong if no AAAA
+// record has been found after maxCNAMEDepth additional lookups.
+func (r *Resolver) LookupAAAAFollow(ctx context.Context, fqdn string) (recs []*AAAARecord, ttls []uint32, chain []string, err error) {
+	chain, err = r.followCNAMEs(fqdn, func(name string) (msg *message, found bool, err error) {
+		recs, ttls, msg, err = r.lookupAAAA(ctx, name)
+		return msg, len(recs) > 0, err
+	})
+	return
+}
+
+// followCNAMEs calls the given lookup function on the given FQDN, then on the
+// end of the CNAME chain found in the response, and so on, until the function
+// reports having found records, or the response doesn't hold any CNAME record
+// for the name.
+// Returns the names the function has been called on, followed by the names of
+// the CNAME chain in the last response.
+// Returns the function's error, or ErrCNAMEChainTooLong if the chain requires
+// more than maxCNAMEDepth additional lookups.
+func (r *Resolver) followCNAMEs(fqdn string, lookup func(name string) (msg *message, found bool, err error)) (chain []string, err error) {
+	name := strings.TrimSuffix(fqdn, ".")
+	chain = []string{name}
+	for depth := 0; ; depth++ {
+		// Responses only holding CNAME records are NODATA ones if the
+		// resolver reports them, but the chain can still be followed.
+		msg, found, err := lookup(name)
+		if msg == nil || (err != nil && !errors.Is(err, ErrNoData)) {
+			return chain, err
+		}
+
+		targets := cnameChain(msg, name)
+		chain = append(chain, targets...)
+		if found || len(targets) == 0 {
+			return chain, err
+		}
+
+		if depth == maxCNAMEDepth {
+			return chain, ErrCNAMEChainTooLong
+		}
+
+		name = targets[len(targets)-1]
+	}
+}
+
+// cnameChain returns the successive targets of the CNAME records of the given
+// message, starting with the one of the record owned by the given name.
+// Returns nil if the message doesn't hold a CNAME record for the name.
+func cnameChain(msg *message, name string) (targets []string) {
+	// Each record can only appear once in the chain, which stops loops within a
+	// single response.
+	for range msg.answers {
+		next, ok := cnameTarget(msg, name)
+		if !ok {
+			break
+		}
+
+		targets = append(targets, next)
+		name = next
+	}
+
+	return
+}
+
+// cnameTarget returns the target of the CNAME record of the given message owned
+// by the given name, if there is one. Names are compared regardless of their
+// trailing dot, since the names of records have one if the resolver normalizes
+// them.
+func cnameTarget(msg *message, name string) (string, bool) {
+	for _, a := range msg.answers {
+		if rec, ok := a.parsed.(*CNAMERecord); ok && a.t == CNAME && strings.EqualFold(strings.TrimSuffix(a.name, "."), strings.TrimSuffix(name, ".")) {
+			return rec.CNAME, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,76 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+// newCNAMEResolver returns a resolver answering queries for the names in the
+// given map with a CNAME record to the mapped name, and queries for other names
+// with an A record. The number of queries is counted in calls.
+func newCNAMEResolver(cnames map[string]string, calls *int) *Resolver {
+	return newStubResolver(func(q []byte) []byte {
+		*calls++
+
+		p := &parser{res: q}
+		name, _, err := p.parseName(q[DNSMsgHeaderLen:])
+		if err != nil {
+			return nil
+		}
+
+		target, ok := cnames[name]
+		if !ok {
+			return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		}
+
+		rdata := bytes.NewBuffer(nil)
+		writeName(rdata, target)
+		return buildResponse(q, buildRR(CNAME, 3600, rdata.Bytes()))
+	})
+}
+
+func TestLookupAFollow(t *testing.T) {
+	// Responses only holding CNAME records are NODATA ones if the resolver
+	// reports them, but the chain must still be followed.
+	for _, reportNoData := range []bool{false, true} {
+		var calls int
+		r := newCNAMEResolver(map[string]string{
+			"brendan.abolivier.bzh":      "blog.brendan.abolivier.bzh",
+			"blog.brendan.abolivier.bzh": "aragog.brendanabolivier.com",
+		}, &calls)
+		r.ReportNoData = reportNoData
+
+		recs, ttls, chain, err := r.LookupAFollow(context.Background(), "brendan.abolivier.bzh.")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(recs) != 1 || recs[0].IP4 != expectedA || ttls[0] != 300 || calls != 3 {
+			t.FailNow()
+		}
+
+		expected := []string{"brendan.abolivier.bzh", "blog.brendan.abolivier.bzh", "aragog.brendanabolivier.com"}
+		if !reflect.DeepEqual(chain, expected) {
+			t.Errorf("unexpected chain %v", chain)
+		}
+	}
+}
+
+func TestLookupAFollowLoop(t *testing.T) {
+	var calls int
+	r := newCNAMEResolver(map[string]string{
+		"brendan.abolivier.bzh":      "blog.brendan.abolivier.bzh",
+		"blog.brendan.abolivier.bzh": "brendan.abolivier.bzh",
+	}, &calls)
+
+	recs, _, _, err := r.LookupAFollow(context.Background(), "brendan.abolivier.bzh")
+	if err != ErrCNAMEChainTooLong || len(recs) != 0 {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if calls != maxCNAMEDepth+1 {
+		t.Errorf("unexpected number of queries %d", calls)
+	}
+}
@@ -2,33 +2,170 @@ package doh
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// exchangeHTTPS sends a given query to a given resolver using a DoH POST
-// request as described in RFC 8484, and returns the response's body.
+// defaultHTTPClient is the client DoH requests are sent with if the resolver
+// doesn't have one. Unlike http.DefaultClient, it has a timeout.
+var defaultHTTPClient = &http.Client{Timeout: DefaultHTTPTimeout}
+
+var (
+	sharedClientsMu sync.Mutex
+	sharedClients   = make(map[string]*http.Client)
+)
+
+// SharedHTTPClient returns a http.Client dedicated to the given DoH host. Every
+// call with the same host returns the same client, so using it as the
+// HTTPClient of several resolvers pointing at that host lets them share their
+// connections and TLS session tickets instead of each performing their own
+// handshakes. The client has a timeout of DefaultHTTPTimeout.
+func SharedHTTPClient(host string) *http.Client {
+	sharedClientsMu.Lock()
+	defer sharedClientsMu.Unlock()
+
+	if client, ok := sharedClients[host]; ok {
+		return client
+	}
+
+	client := &http.Client{Transport: NewHTTPTransport(), Timeout: DefaultHTTPTimeout}
+
+	sharedClients[host] = client
+	return client
+}
+
+// maxIdleConnsPerHost is the number of idle connections to each host kept by
+// the transports returned by NewHTTPTransport. It's higher than the default of
+// net/http since DoH clients usually send all of their requests to the same
+// host, which matters if the server doesn't support HTTP/2.
+const maxIdleConnsPerHost = 16
+
+// NewHTTPTransport returns a http.Transport suited to DoH, which is the
+// transport of http.DefaultTransport tuned so that requests to the same host
+// reuse their connections and TLS sessions, and which attempts to use HTTP/2
+// (advertising it with ALPN) even if DoH requests are sent with a custom TLS
+// configuration, since section 5.2 of RFC 8484 recommends it for its
+// multiplexing.
+// HTTP/3 isn't supported by net/http, but a third-party round tripper
+// implementing it can be used as the transport of a resolver's HTTPClient
+// instead, as long as its BootstrapAddr isn't set.
+func NewHTTPTransport() *http.Transport {
+	var transport *http.Transport
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		}
+	}
+
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.TLSClientConfig = &tls.Config{
+		NextProtos:         []string{"h2", "http/1.1"},
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+
+	return transport
+}
+
+// exchangeHTTPS sends a given query to a given resolver using a DoH POST or GET
+// request (depending on r.Method) as described in RFC 8484, and returns the
+// response's body. The request is bound to the given context, and to
+// r.QueryTimeout if it's set.
 // Returns an error if there was an issue sending the request or reading the
-// response body.
-func (r *Resolver) exchangeHTTPS(q []byte) (a []byte, err error) {
-	url := fmt.Sprintf("https://%s/dns-query", r.Host)
-	body := bytes.NewBuffer(q)
+// response body, or an error wrapping ErrInvalidMediaType if r.Accept or
+// r.ContentType isn't a valid media type.
+func (r *Resolver) exchangeHTTPS(ctx context.Context, q []byte) (a []byte, err error) {
+	if r.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.QueryTimeout)
+		defer cancel()
+	}
 
-	req, err := http.NewRequest("POST", url, body)
+	req, err := r.newRequest(ctx, q)
 	if err != nil {
 		return
 	}
 
-	req.Header.Add("Accept", "application/dns-message")
-	req.Header.Add("Content-Type", "application/dns-message")
+	accept, err := mediaType(r.Accept, dnsMessageMediaType)
+	if err != nil {
+		return
+	}
+
+	return r.send(req, accept)
+}
+
+// dnsMessageMediaType is the media type of DNS messages in wire format, as
+// described in section 6 of RFC 8484.
+const dnsMessageMediaType = "application/dns-message"
+
+// mediaType returns the given media type, or the given default one if it's
+// empty.
+// Returns an error wrapping ErrInvalidMediaType if the media type isn't valid.
+func mediaType(value, def string) (string, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	if _, _, err := mime.ParseMediaType(value); err != nil {
+		return "", fmt.Errorf("%w %q: %v", ErrInvalidMediaType, value, err)
+	}
+
+	return value, nil
+}
+
+// send sends the given request, accepting responses of the given media type
+// (which can have parameters), after adding the resolver's headers and
+// credentials to it, and returns the response's body.
+// Returns an error if there was an issue sending the request or reading the
+// response body, a *HTTPError if the server didn't respond with a 200 status
+// code, an error wrapping ErrUnexpectedContentType if the response isn't of
+// the accepted media type, or ErrBootstrapTransport if r.BootstrapAddr is set
+// but the resolver's HTTP client doesn't allow for it.
+func (r *Resolver) send(req *http.Request, accept string) (a []byte, err error) {
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", defaultUserAgent)
+	// Custom headers override the default ones, but not the credentials.
+	for k, values := range r.Headers {
+		req.Header.Del(k)
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	if r.Auth != nil {
+		r.Auth.apply(req)
+	}
 
 	client := r.HTTPClient
 	if client == nil {
-		client = http.DefaultClient
+		client = defaultHTTPClient
 	}
 
+	if r.BootstrapAddr != "" {
+		client, err = r.bootstrapClient(client, req.URL)
+		if err != nil {
+			return
+		}
+	}
+
+	req, reportConn := r.withConnTrace(req)
 	resp, err := client.Do(req)
+	reportConn()
 	if err != nil {
 		return
 	}
@@ -36,9 +173,130 @@ func (r *Resolver) exchangeHTTPS(q []byte) (a []byte, err error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("HTTPS server returned with non-OK code %d", resp.StatusCode)
+		// Don't fail if the body can't be read, since the status is the
+		// most relevant part of the error.
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBodyLen))
+		err = &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			err.(*HTTPError).RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return
+	}
+
+	if ct := resp.Header.Get("Content-Type"); !contentTypeMatches(ct, accept) {
+		err = fmt.Errorf("%w %q", ErrUnexpectedContentType, ct)
 		return
 	}
 
 	return ioutil.ReadAll(resp.Body)
 }
+
+// contentTypeMatches returns whether the given Content-Type header value is of
+// the given media type, ignoring the parameters of both. The generic
+// application/json media type is accepted in place of application/dns-json,
+// which some DoH JSON APIs respond with.
+func contentTypeMatches(contentType, mediaType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if accepted, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = accepted
+	}
+
+	return mt == mediaType || (mediaType == "application/dns-json" && mt == "application/json")
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or a HTTP date, as described in section 10.2.3 of RFC 9110,
+// and returns the time to wait for from the given time.
+// Returns zero if the value is invalid, or if the date is in the past.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil || date.Before(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
+
+// maxHTTPErrorBodyLen is the maximum number of bytes read from the body of a
+// non-OK response in order to include it in the resulting HTTPError.
+const maxHTTPErrorBodyLen = 512
+
+// defaultUserAgent is the User-Agent DoH requests are sent with, unless
+// overridden in the resolver's headers.
+const defaultUserAgent = "go-doh-client (+https://github.com/babolivier/go-doh-client)"
+
+// defaultPath is the path DoH requests are sent to if none is configured, as
+// used in the examples of RFC 8484.
+const defaultPath = "/dns-query"
+
+// newRequest builds the HTTP request to send the given query with, using the
+// method configured in r.Method. With GET, the query is encoded using base64url
+// without padding into the dns parameter of the URL, as described in section
+// 4.1 of RFC 8484.
+// Returns ErrMethod if the method isn't supported, ErrInvalidURL if the host
+// and path don't form a valid URL, or an error wrapping ErrInvalidMediaType if
+// r.ContentType isn't a valid media type.
+func (r *Resolver) newRequest(ctx context.Context, q []byte) (*http.Request, error) {
+	u, err := r.url()
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Method {
+	case "", http.MethodPost:
+		contentType, err := mediaType(r.ContentType, dnsMessageMediaType)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewBuffer(q))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("Content-Type", contentType)
+		return req, nil
+	case http.MethodGet:
+		params := u.Query()
+		params.Set("dns", base64.RawURLEncoding.EncodeToString(q))
+		u.RawQuery = params.Encode()
+		return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	}
+
+	return nil, ErrMethod
+}
+
+// url returns the URL to send DoH requests to, built from r.Host and r.Path.
+// Returns ErrInvalidURL if they don't form a valid URL.
+func (r *Resolver) url() (*url.URL, error) {
+	path := r.Path
+	if path == "" {
+		path = defaultPath
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%w: path %q doesn't start with a slash", ErrInvalidURL, path)
+	}
+
+	u, err := url.Parse("https://" + r.Host + path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: invalid host %q", ErrInvalidURL, r.Host)
+	}
+
+	return u, nil
+}
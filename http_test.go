@@ -0,0 +1,413 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dohHandler returns a DoH server handler which answers queries with the given
+// function.
+func dohHandler(answer func(q []byte) []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answer(q))
+	})
+}
+
+func TestSharedHTTPClient(t *testing.T) {
+	srv := httptest.NewUnstartedServer(dohHandler(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	}))
+
+	var conns int32
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+
+	srv.StartTLS()
+	defer srv.Close()
+
+	host := srv.Listener.Addr().String()
+	client := SharedHTTPClient(host)
+	if SharedHTTPClient(host) != client {
+		t.Fatal("expected the same client for the same host")
+	}
+
+	if client.Timeout != DefaultHTTPTimeout {
+		t.Errorf("unexpected timeout %s", client.Timeout)
+	}
+
+	// Trust the test server's certificate.
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	for _, r := range []*Resolver{
+		{Host: host, Class: IN, HTTPClient: SharedHTTPClient(host)},
+		{Host: host, Class: IN, HTTPClient: SharedHTTPClient(host)},
+	} {
+		if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if c := atomic.LoadInt32(&conns); c != 1 {
+		t.Errorf("expected a single connection, got %d", c)
+	}
+
+	if transport.TLSClientConfig.ClientSessionCache == nil {
+		t.Fail()
+	}
+}
+
+func TestNewHTTPTransport(t *testing.T) {
+	var proto int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.StoreInt32(&proto, int32(req.ProtoMajor))
+		dohHandler(func(q []byte) []byte {
+			return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		}).ServeHTTP(w, req)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	transport := NewHTTPTransport()
+	if !transport.ForceAttemptHTTP2 || transport.TLSClientConfig.ClientSessionCache == nil {
+		t.FailNow()
+	}
+
+	// Trust the test server's certificate.
+	transport.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	r := &Resolver{Host: srv.Listener.Addr().String(), Class: IN, HTTPClient: &http.Client{Transport: transport}}
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := atomic.LoadInt32(&proto); p != 2 {
+		t.Errorf("expected HTTP/2, got HTTP/%d", p)
+	}
+}
+
+func TestOnConn(t *testing.T) {
+	srv := httptest.NewTLSServer(dohHandler(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	}))
+	defer srv.Close()
+
+	var infos []ConnInfo
+	r := &Resolver{
+		Host:       srv.Listener.Addr().String(),
+		Class:      IN,
+		HTTPClient: srv.Client(),
+		OnConn: func(info ConnInfo) {
+			infos = append(infos, info)
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 reports, got %d", len(infos))
+	}
+
+	if infos[0].Reused || infos[0].TLSDuration == 0 || infos[0].ConnectDuration == 0 {
+		t.Errorf("unexpected first connection %+v", infos[0])
+	}
+
+	if !infos[1].Reused || infos[1].TLSDuration != 0 {
+		t.Errorf("unexpected second connection %+v", infos[1])
+	}
+}
+
+func TestDefaultHTTPClientTimeout(t *testing.T) {
+	if defaultHTTPClient.Timeout != DefaultHTTPTimeout {
+		t.Fatalf("unexpected default timeout %s", defaultHTTPClient.Timeout)
+	}
+
+	// A server which accepts connections but never responds.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	// Shorten the default timeout so the test doesn't take DefaultHTTPTimeout.
+	defaultHTTPClient.Timeout = 100 * time.Millisecond
+	defer func() { defaultHTTPClient.Timeout = DefaultHTTPTimeout }()
+
+	r := &Resolver{Host: l.Addr().String(), Class: IN}
+	start := time.Now()
+	_, _, err = r.LookupA("brendan.abolivier.bzh")
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %s", elapsed)
+	}
+}
+
+// knownQueryGETURL is the URL of the GET request for the query for
+// brendan.abolivier.bzh A IN with ID 0, as encoded by encodeQuery.
+const knownQueryGETURL = "https://doh.example.com/dns-query?dns=AAABEAABAAAAAAAAB2JyZW5kYW4JYWJvbGl2aWVyA2J6aAAAAQAB"
+
+func TestGETRequest(t *testing.T) {
+	r := &Resolver{Host: "doh.example.com", Method: http.MethodGet}
+
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+	q[0], q[1] = 0, 0
+
+	req, err := r.newRequest(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Method != http.MethodGet || req.URL.String() != knownQueryGETURL || req.Body != nil {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL)
+	}
+}
+
+func TestLookupGET(t *testing.T) {
+	r := newStubResolver(nil)
+	r.Method = http.MethodGet
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet || req.Header.Get("Accept") != "application/dns-message" {
+			t.Errorf("unexpected request %s with headers %v", req.Method, req.Header)
+		}
+
+		q, err := base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/dns-message"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191})))),
+			Request:    req,
+		}, nil
+	})
+
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA {
+		t.Fail()
+	}
+}
+
+func TestUnsupportedMethod(t *testing.T) {
+	r := newStubResolver(nil)
+	r.Method = http.MethodPut
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrMethod {
+		t.Fail()
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{zeroID: true})
+
+	r := &Resolver{Host: "doh.example.com", Path: "/resolve"}
+	req, err := r.newRequest(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.URL.String() != "https://doh.example.com/resolve" {
+		t.Errorf("unexpected URL %s", req.URL)
+	}
+
+	// The dns parameter is added to the path's query string.
+	r.Path = "/dns-query?account=brendan"
+	r.Method = http.MethodGet
+	req, err = r.newRequest(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.URL.Query().Get("account") != "brendan" || req.URL.Query().Get("dns") == "" {
+		t.Errorf("unexpected URL %s", req.URL)
+	}
+}
+
+func TestInvalidRequestURL(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+
+	for _, r := range []*Resolver{
+		{Host: "doh.example.com", Path: "resolve"},
+		{Host: "doh.example.com:port"},
+	} {
+		if _, err := r.newRequest(context.Background(), q); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("expected ErrInvalidURL for %s%s, got %v", r.Host, r.Path, err)
+		}
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var header http.Header
+	r := newStubResolver(nil)
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+		return nil, errors.New("stop")
+	})
+
+	r.LookupA("brendan.abolivier.bzh")
+	if header.Get("User-Agent") != defaultUserAgent ||
+		header.Get("Accept") != "application/dns-message" ||
+		header.Get("Content-Type") != "application/dns-message" {
+		t.Errorf("unexpected default headers %v", header)
+	}
+
+	r.Headers = http.Header{
+		"X-Client-Id": {"brendan"},
+		"user-agent":  {"my-app/1.0"},
+	}
+	r.LookupA("brendan.abolivier.bzh")
+	if header.Get("X-Client-Id") != "brendan" ||
+		header.Get("User-Agent") != "my-app/1.0" ||
+		header.Get("Accept") != "application/dns-message" {
+		t.Errorf("unexpected custom headers %v", header)
+	}
+}
+
+func TestCustomMediaTypes(t *testing.T) {
+	r := newStubResolver(nil)
+	r.Accept = "application/x-dns-message; version=2"
+	r.ContentType = "application/x-dns-query"
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept") != r.Accept || req.Header.Get("Content-Type") != r.ContentType {
+			t.Errorf("unexpected headers %v", req.Header)
+		}
+
+		q, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/x-dns-message"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191})))),
+			Request:    req,
+		}, nil
+	})
+
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA {
+		t.Fail()
+	}
+
+	for _, r := range []*Resolver{
+		{Host: "doh.example.com", Accept: "not a media type"},
+		{Host: "doh.example.com", ContentType: "application/"},
+	} {
+		if _, _, err := r.LookupA("brendan.abolivier.bzh"); !errors.Is(err, ErrInvalidMediaType) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+}
+
+func TestUnexpectedContentType(t *testing.T) {
+	for _, format := range []Format{FormatWire, FormatJSON} {
+		r := newStubResolver(nil)
+		r.Format = format
+		r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+				Body:       ioutil.NopCloser(strings.NewReader("<html>Please log in</html>")),
+				Request:    req,
+			}, nil
+		})
+
+		if _, _, err := r.LookupA("brendan.abolivier.bzh"); !errors.Is(err, ErrUnexpectedContentType) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+}
+
+func TestContentTypeMatches(t *testing.T) {
+	tests := []struct {
+		contentType string
+		mediaType   string
+		expected    bool
+	}{
+		{"application/dns-message", "application/dns-message", true},
+		{"Application/DNS-Message; foo=bar", "application/dns-message", true},
+		{"application/json; charset=utf-8", "application/dns-json", true},
+		{"application/json", "application/dns-message", false},
+		{"", "application/dns-message", false},
+	}
+
+	for _, test := range tests {
+		if contentTypeMatches(test.contentType, test.mediaType) != test.expected {
+			t.Errorf("%q doesn't match %q as expected", test.contentType, test.mediaType)
+		}
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	r := newStubResolver(nil)
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Status:     "429 Too Many Requests",
+			Body:       ioutil.NopCloser(strings.NewReader("rate limited\n" + strings.Repeat("a", 1024))),
+			Request:    req,
+		}, nil
+	})
+
+	_, _, err := r.LookupA("brendan.abolivier.bzh")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if httpErr.StatusCode != http.StatusTooManyRequests || httpErr.Status != "429 Too Many Requests" {
+		t.Fail()
+	}
+
+	if len(httpErr.Body) != maxHTTPErrorBodyLen || !strings.HasPrefix(string(httpErr.Body), "rate limited\n") {
+		t.Errorf("unexpected body %q", httpErr.Body)
+	}
+}
@@ -0,0 +1,52 @@
+package doh
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// LookupIP performs concurrent DoH lookups on A and AAAA records for the given
+// FQDN, bounded by the given context, and merges their results.
+// Returns the addresses interleaved by family starting with IPv6, as
+// recommended by section 4 of RFC 8305 for clients attempting connections,
+// and TTLs such that ttls[0] is the TTL for ips[0], and so on.
+// If only one of the lookups fails, the addresses from the other one are
+// returned without any error. Returns an *IPLookupError if both fail.
+func (r *Resolver) LookupIP(ctx context.Context, fqdn string) (ips []net.IP, ttls []uint32, err error) {
+	var a []*ARecord
+	var aaaa []*AAAARecord
+	var aTTLs, aaaaTTLs []uint32
+	var aErr, aaaaErr error
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		a, aTTLs, aErr = r.LookupACtx(ctx, fqdn)
+	}()
+	go func() {
+		defer wg.Done()
+		aaaa, aaaaTTLs, aaaaErr = r.LookupAAAACtx(ctx, fqdn)
+	}()
+	wg.Wait()
+
+	if aErr != nil && aaaaErr != nil {
+		return nil, nil, &IPLookupError{AErr: aErr, AAAAErr: aaaaErr}
+	}
+
+	ips = make([]net.IP, 0, len(a)+len(aaaa))
+	ttls = make([]uint32, 0, len(a)+len(aaaa))
+	for i := 0; i < len(a) || i < len(aaaa); i++ {
+		if i < len(aaaa) {
+			ips = append(ips, aaaa[i].IP)
+			ttls = append(ttls, aaaaTTLs[i])
+		}
+		if i < len(a) {
+			ips = append(ips, a[i].IP)
+			ttls = append(ttls, aTTLs[i])
+		}
+	}
+
+	return ips, ttls, nil
+}
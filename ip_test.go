@@ -0,0 +1,107 @@
+package doh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestLookupIP(t *testing.T) {
+	expected := []net.IP{
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("192.0.2.1"),
+		net.ParseIP("2001:db8::2"),
+	}
+
+	r := newStubResolver(func(q []byte) []byte {
+		if DNSType(q[len(q)-3]) == AAAA {
+			return buildResponse(q, buildRR(AAAA, 300, expected[0]), buildRR(AAAA, 200, expected[2]))
+		}
+		return buildResponse(q, buildRR(A, 100, expected[1].To4()))
+	})
+
+	ips, ttls, err := r.LookupIP(context.Background(), "brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ips) != len(expected) {
+		t.Fatalf("unexpected addresses %v", ips)
+	}
+
+	for i, ip := range ips {
+		if !ip.Equal(expected[i]) {
+			t.Errorf("unexpected address %s at index %d", ip, i)
+		}
+	}
+
+	if ttls[0] != 300 || ttls[1] != 100 || ttls[2] != 200 {
+		t.Fail()
+	}
+}
+
+func TestLookupIPPartialFailure(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q)
+		if DNSType(q[len(q)-3]) == AAAA {
+			// SERVFAIL
+			res[3] |= 2
+			return res
+		}
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+
+	ips, _, err := r.LookupIP(context.Background(), "brendan.abolivier.bzh")
+	if err != nil || len(ips) != 1 || ips[0].String() != expectedA {
+		t.Fail()
+	}
+
+	r = newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q)
+		res[3] |= 2
+		return res
+	})
+
+	_, _, err = r.LookupIP(context.Background(), "brendan.abolivier.bzh")
+	if e, ok := err.(*IPLookupError); !ok || e.AErr == nil || e.AAAAErr == nil {
+		t.Fail()
+	}
+}
+
+func TestIPLookupErrorMatch(t *testing.T) {
+	// Both lookups fail with NXDOMAIN.
+	r := newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q)
+		res[3] |= 3
+		return res
+	})
+
+	_, _, err := r.LookupIP(context.Background(), "brendan.abolivier.bzh")
+	if !errors.Is(err, ErrNameError) {
+		t.Errorf("expected ErrNameError in %v", err)
+	}
+
+	var nxErr *NXDomainError
+	if !errors.As(err, &nxErr) {
+		t.Errorf("expected a *NXDomainError in %v", err)
+	}
+
+	// Both lookups fail because the context has been canceled, which is also
+	// reported by DialContext.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+
+	if _, _, err = r.LookupIP(ctx, "brendan.abolivier.bzh"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled in %v", err)
+	}
+
+	if _, err = r.DialContext(ctx, "tcp", "brendan.abolivier.bzh:443"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled from DialContext in %v", err)
+	}
+}
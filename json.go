@@ -0,0 +1,302 @@
+package doh
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Format is the format DoH requests and responses are sent in.
+type Format int
+
+const (
+	// FormatWire uses the DNS wire format, as described in RFC 8484.
+	FormatWire Format = iota
+	// FormatJSON uses the JSON API that some providers (e.g. Google and
+	// Cloudflare) expose, with the application/dns-json media type.
+	FormatJSON
+)
+
+// jsonResponse describes a response from a DoH JSON API.
+type jsonResponse struct {
+	Status    int
+	TC        bool
+	RD        bool
+	RA        bool
+	AD        bool
+	Answer    []jsonRR
+	Authority []jsonRR
+}
+
+// jsonRR describes a record from a response of a DoH JSON API.
+type jsonRR struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// exchangeJSON looks up records of the given type for the given FQDN using the
+// DoH JSON API of the resolver's host, and returns the response's body. The
+// request is bound to the given context, and to r.QueryTimeout if it's set.
+// Returns an error if there was an issue sending the request or reading the
+// response body.
+func (r *Resolver) exchangeJSON(ctx context.Context, fqdn string, t DNSType) (a []byte, err error) {
+	if r.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.QueryTimeout)
+		defer cancel()
+	}
+
+	u, err := r.url()
+	if err != nil {
+		return
+	}
+
+	params := u.Query()
+	params.Set("name", fqdn)
+	params.Set("type", strconv.Itoa(int(t)))
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return
+	}
+
+	accept, err := mediaType(r.Accept, "application/dns-json")
+	if err != nil {
+		return
+	}
+
+	return r.send(req, accept)
+}
+
+// parseJSONResponse parses a response from a DoH JSON API into the same
+// message parseResponse would produce from the equivalent wire response.
+// Records of types other than A, AAAA, CNAME, MX, NS, PTR, SOA and TXT are
+// included in the message without being parsed.
+// Returns ErrCorrupted if the response isn't valid JSON, ErrTruncated if it's
+// truncated, or a *RCodeError (or a *NXDomainError for name errors) if it
+// includes an error code (in which case the message is returned along with the
+// error).
+// If opts.bestEffort is false, parsing stops at the first answer which
+// couldn't be parsed, and ErrCorrupted is returned. Otherwise, the message is
+// returned with the answers which could be parsed, along with an AnswerErrors
+// describing the others. opts.normalizeNames is the only other option used.
+func parseJSONResponse(res []byte, opts parseOptions) (*message, error) {
+	var jres jsonResponse
+	if err := json.Unmarshal(res, &jres); err != nil {
+		return nil, ErrCorrupted
+	}
+
+	if jres.TC {
+		return nil, ErrTruncated
+	}
+
+	msg := new(message)
+	msg.header = Header{
+		RecursionDesired:   jres.RD,
+		RecursionAvailable: jres.RA,
+		AuthenticatedData:  jres.AD,
+		RCode:              jres.Status,
+	}
+
+	p := new(parser)
+	p.normalizeNames = opts.normalizeNames
+
+	var errs AnswerErrors
+	var err error
+	msg.answers, errs, err = p.parseJSONRRs(jres.Answer, opts.bestEffort)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.authority, _, err = p.parseJSONRRs(jres.Authority, opts.bestEffort)
+	if err != nil {
+		return nil, err
+	}
+
+	if jres.Status == rcodeNameError {
+		return msg, newNXDomainError(msg)
+	}
+
+	if jres.Status != 0 {
+		return msg, &RCodeError{Code: jres.Status}
+	}
+
+	if len(errs) > 0 {
+		return msg, errs
+	}
+
+	return msg, nil
+}
+
+// parseJSONRRs parses the given records from a response of a DoH JSON API.
+// If bestEffort is false, parsing stops at the first record which couldn't be
+// parsed, and ErrCorrupted is returned. Otherwise, the records which could be
+// parsed are returned along with errors describing the others.
+func (p *parser) parseJSONRRs(rrs []jsonRR, bestEffort bool) (answers []answer, errs AnswerErrors, err error) {
+	answers = make([]answer, 0, len(rrs))
+	for i, rr := range rrs {
+		a := answer{
+			name:  p.jsonName(rr.Name),
+			t:     DNSType(rr.Type),
+			class: IN,
+			ttl:   rr.TTL,
+		}
+
+		a.parsed, err = p.parseJSONData(a.t, rr.Data)
+		if err != nil {
+			if !bestEffort {
+				return nil, nil, err
+			}
+			errs = append(errs, &AnswerError{Index: i, Err: err})
+			continue
+		}
+
+		a.setRRHeader()
+		answers = append(answers, a)
+	}
+
+	return answers, errs, nil
+}
+
+// parseJSONData parses the data of a record of the given type from a response
+// of a DoH JSON API, which is the record's RDATA in presentation format.
+// Returns nil if the type isn't supported, or ErrCorrupted if the data couldn't
+// be parsed.
+func (p *parser) parseJSONData(t DNSType, data string) (Record, error) {
+	switch t {
+	case A:
+		ip := net.ParseIP(data).To4()
+		if ip == nil {
+			return nil, ErrCorrupted
+		}
+		return p.parseA(ip)
+	case AAAA:
+		ip := net.ParseIP(data)
+		if ip == nil || ip.To4() != nil {
+			return nil, ErrCorrupted
+		}
+		return p.parseAAAA(ip.To16())
+	case CNAME:
+		return &CNAMERecord{CNAME: p.jsonName(data)}, nil
+	case NS:
+		ns := new(NSRecord)
+		ns.Host = p.jsonName(data)
+		return ns, nil
+	case PTR:
+		return &PTRRecord{PTR: p.jsonName(data)}, nil
+	case MX:
+		fields := strings.Fields(data)
+		if len(fields) != 2 {
+			return nil, ErrCorrupted
+		}
+
+		pref, err := strconv.ParseUint(fields[0], 10, 16)
+		if err != nil {
+			return nil, ErrCorrupted
+		}
+
+		mx := new(MXRecord)
+		mx.Pref = uint16(pref)
+		mx.Host = p.jsonName(fields[1])
+		return mx, nil
+	case SOA:
+		fields := strings.Fields(data)
+		if len(fields) != 7 {
+			return nil, ErrCorrupted
+		}
+
+		var values [5]uint32
+		for i, f := range fields[2:] {
+			v, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, ErrCorrupted
+			}
+			values[i] = uint32(v)
+		}
+
+		return &SOARecord{
+			PrimaryNS:   p.jsonName(fields[0]),
+			RespMailbox: p.jsonName(fields[1]),
+			Serial:      values[0],
+			Refresh:     values[1],
+			Retry:       values[2],
+			Expire:      values[3],
+			Minimum:     values[4],
+		}, nil
+	case TXT:
+		strs, err := parseJSONTXT(data)
+		if err != nil {
+			return nil, err
+		}
+		return &TXTRecord{TXT: strings.Join(strs, ""), Strings: strs}, nil
+	case SPF:
+		strs, err := parseJSONTXT(data)
+		if err != nil {
+			return nil, err
+		}
+		return &SPFRecord{SPF: strings.Join(strs, ""), Strings: strs}, nil
+	}
+
+	return nil, nil
+}
+
+// jsonName returns the given name from a response of a DoH JSON API, which is
+// fully qualified, in the same form as names parsed from wire responses are.
+func (p *parser) jsonName(name string) string {
+	return p.recordName(strings.TrimSuffix(name, "."))
+}
+
+// parseJSONTXT parses the data of a TXT or SPF record from a response of a DoH
+// JSON API. Some APIs send it as a sequence of quoted character-strings (e.g.
+// "\"v=spf1\" \" -all\""), and others as the bare text of a single string.
+// Returns ErrCorrupted if a quoted string isn't properly terminated.
+func parseJSONTXT(data string) ([]string, error) {
+	if !strings.HasPrefix(data, `"`) {
+		return []string{data}, nil
+	}
+
+	var strs []string
+	for len(data) > 0 {
+		data = strings.TrimLeft(data, " ")
+		if len(data) == 0 {
+			break
+		}
+
+		if data[0] != '"' {
+			return nil, ErrCorrupted
+		}
+
+		var b strings.Builder
+		terminated := false
+		i := 1
+		for ; i < len(data); i++ {
+			if data[i] == '\\' && i+1 < len(data) {
+				i++
+				b.WriteByte(data[i])
+				continue
+			}
+
+			if data[i] == '"' {
+				terminated = true
+				break
+			}
+
+			b.WriteByte(data[i])
+		}
+
+		if !terminated {
+			return nil, ErrCorrupted
+		}
+
+		strs = append(strs, b.String())
+		data = data[i+1:]
+	}
+
+	return strs, nil
+}
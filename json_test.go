@@ -0,0 +1,153 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const jsonResponseSample = `{
+  "Status": 0, "TC": false, "RD": true, "RA": true, "AD": true, "CD": false,
+  "Question": [{"name": "brendan.abolivier.bzh.", "type": 1}],
+  "Answer": [
+    {"name": "brendan.abolivier.bzh.", "type": 5, "TTL": 3600, "data": "blog.brendan.abolivier.bzh."},
+    {"name": "blog.brendan.abolivier.bzh.", "type": 1, "TTL": 1800, "data": "51.38.47.191"},
+    {"name": "blog.brendan.abolivier.bzh.", "type": 28, "TTL": 1800, "data": "2001:41d0:302:1100::a:d8f1"},
+    {"name": "abolivier.bzh.", "type": 15, "TTL": 300, "data": "1 mx3.ovh.net."},
+    {"name": "abolivier.bzh.", "type": 2, "TTL": 300, "data": "dns200.anycast.me."},
+    {"name": "abolivier.bzh.", "type": 16, "TTL": 300, "data": "\"v=spf1 include:mx.ovh.com\" \" ~all\""},
+    {"name": "abolivier.bzh.", "type": 16, "TTL": 300, "data": "4|https://brendan.abolivier.bzh"},
+    {"name": "abolivier.bzh.", "type": 13, "TTL": 300, "data": "unsupported"}
+  ]
+}`
+
+func TestParseJSONResponse(t *testing.T) {
+	msg, err := parseJSONResponse([]byte(jsonResponseSample), parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !msg.header.AuthenticatedData || len(msg.answers) != 8 {
+		t.FailNow()
+	}
+
+	expected := []interface{}{
+		&CNAMERecord{RRHeader: RRHeader{Owner: "brendan.abolivier.bzh", TTL: 3600}, CNAME: "blog.brendan.abolivier.bzh"},
+		nil, // A, checked below
+		nil, // AAAA, checked below
+		&MXRecord{RRHeader: RRHeader{Owner: "abolivier.bzh", TTL: 300}, Host: "mx3.ovh.net", Pref: 1},
+		&NSRecord{RRHeader: RRHeader{Owner: "abolivier.bzh", TTL: 300}, Host: "dns200.anycast.me"},
+		&TXTRecord{
+			RRHeader: RRHeader{Owner: "abolivier.bzh", TTL: 300},
+			TXT:      expectedTXTMultiFirst + expectedTXTMultiSecond,
+			Strings:  []string{expectedTXTMultiFirst, expectedTXTMultiSecond},
+		},
+		&TXTRecord{RRHeader: RRHeader{Owner: "abolivier.bzh", TTL: 300}, TXT: expectedTXT, Strings: []string{expectedTXT}},
+		nil,
+	}
+
+	for i, a := range msg.answers {
+		switch a.t {
+		case A:
+			if a.parsed.(*ARecord).IP4 != expectedA || a.ttl != 1800 || a.name != "blog.brendan.abolivier.bzh" {
+				t.Errorf("unexpected A answer %+v", a)
+			}
+		case AAAA:
+			// The address is formatted the same way as by the wire parser.
+			if a.parsed.(*AAAARecord).IP6 != expectedAAAA {
+				t.Errorf("unexpected AAAA record %+v", a.parsed)
+			}
+		default:
+			if !reflect.DeepEqual(a.parsed, expected[i]) {
+				t.Errorf("unexpected record %+v for answer %d", a.parsed, i)
+			}
+		}
+	}
+}
+
+func TestParseJSONResponseErrors(t *testing.T) {
+	if _, err := parseJSONResponse([]byte("not json"), parseOptions{}); err != ErrCorrupted {
+		t.Fail()
+	}
+
+	if _, err := parseJSONResponse([]byte(`{"Status": 0, "TC": true}`), parseOptions{}); err != ErrTruncated {
+		t.Fail()
+	}
+
+	msg, err := parseJSONResponse([]byte(`{"Status": 3, "Authority": [{"name": "abolivier.bzh.", "type": 6, "TTL": 300, "data": "dns200.anycast.me. tech.ovh.net. 1 2 3 4 5"}]}`), parseOptions{})
+	if err == nil || msg == nil || len(msg.authority) != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var nxErr *NXDomainError
+	if !errors.As(err, &nxErr) || nxErr.SOA == nil || nxErr.TTL != 5 {
+		t.Fail()
+	}
+
+	invalid := []byte(`{"Status": 0, "Answer": [{"name": "a.", "type": 1, "TTL": 300, "data": "nope"}, {"name": "a.", "type": 1, "TTL": 300, "data": "51.38.47.191"}]}`)
+	if _, err := parseJSONResponse(invalid, parseOptions{}); err != ErrCorrupted {
+		t.Fail()
+	}
+
+	msg, err = parseJSONResponse(invalid, parseOptions{bestEffort: true})
+	if _, ok := err.(AnswerErrors); !ok || len(msg.answers) != 1 {
+		t.Fail()
+	}
+}
+
+func TestLookupJSON(t *testing.T) {
+	r := newStubResolver(nil)
+	r.Format = FormatJSON
+	r.Path = "/resolve"
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet ||
+			req.URL.String() != "https://doh.example.com/resolve?name=brendan.abolivier.bzh&type=1" ||
+			req.Header.Get("Accept") != "application/dns-json" {
+			t.Errorf("unexpected request %s %s with headers %v", req.Method, req.URL, req.Header)
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/dns-json; charset=utf-8"}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(jsonResponseSample))),
+			Request:    req,
+		}, nil
+	})
+
+	recs, ttls, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA || ttls[0] != 1800 {
+		t.Fail()
+	}
+}
+
+func TestLookupJSONClass(t *testing.T) {
+	var queries int
+	r := newStubResolver(nil)
+	r.Format = FormatJSON
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		queries++
+		return nil, errors.New("unexpected request")
+	})
+
+	// JSON APIs only look up IN records, so other classes must not silently
+	// return them.
+	r.Class = CH
+	if _, _, err := r.LookupTXT("version.bind"); err != ErrJSONClass {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if _, err := r.LookupRaw(context.Background(), "version.bind", TXT, CH); err != ErrJSONClass {
+		t.Errorf("unexpected raw error %v", err)
+	}
+
+	if queries != 0 {
+		t.Errorf("expected no query, got %d", queries)
+	}
+}
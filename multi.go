@@ -0,0 +1,100 @@
+package doh
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// MultiResolver handles lookups against several resolvers, trying each of them
+// in order until one succeeds.
+type MultiResolver struct {
+	// The resolvers to try, in order.
+	Resolvers []*Resolver
+	// StopOnNameError, when true, makes lookups stop at the first resolver
+	// which reports that the name doesn't exist (i.e. NXDOMAIN), since that's
+	// a definitive answer, instead of trying the next resolvers.
+	StopOnNameError bool
+}
+
+// Do calls f with each of m's resolvers in order, until it returns without an
+// error, which is useful to perform a lookup with failover, e.g.:
+//
+//	var recs []*ARecord
+//	r, err := m.Do(ctx, func(r *Resolver) (err error) {
+//		recs, _, err = r.LookupACtx(ctx, "example.com")
+//		return
+//	})
+//
+// Returns the resolver f succeeded with, so that callers can know which host
+// answered, and pin subsequent related lookups to it. If m.StopOnNameError is
+// true and f returns an error matching ErrNameError, the resolver is returned
+// along with that error.
+// Returns ErrNoResolver if m doesn't have any resolver, the context's error if
+// it's done before f succeeds, or a ResolverErrors holding the error f
+// returned with each resolver if it didn't succeed with any.
+func (m *MultiResolver) Do(ctx context.Context, f func(r *Resolver) error) (*Resolver, error) {
+	if len(m.Resolvers) == 0 {
+		return nil, ErrNoResolver
+	}
+
+	var errs ResolverErrors
+	for _, r := range m.Resolvers {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		err := f(r)
+		if err == nil {
+			return r, nil
+		}
+
+		if m.StopOnNameError && errors.Is(err, ErrNameError) {
+			return r, err
+		}
+
+		errs = append(errs, &ResolverError{Host: r.Host, Err: err})
+	}
+
+	// The context might have been done while f was called with the last
+	// resolver.
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	return nil, errs
+}
+
+// Lookup performs a DoH lookup on records of the given type for the given
+// FQDN, bounded by the given context, with each of m's resolvers in order until
+// one succeeds. See Resolver.Lookup for the results, and Do for the errors.
+func (m *MultiResolver) Lookup(ctx context.Context, fqdn string, t DNSType) (recs []Record, ttls []uint32, err error) {
+	_, err = m.Do(ctx, func(r *Resolver) (err error) {
+		recs, ttls, err = r.Lookup(ctx, fqdn, t)
+		return
+	})
+	return
+}
+
+// LookupResponse performs a DoH lookup on records of the given type for the
+// given FQDN, bounded by the given context, with each of m's resolvers in order
+// until one succeeds. See Resolver.LookupResponse for the results, and Do for
+// the errors.
+func (m *MultiResolver) LookupResponse(ctx context.Context, fqdn string, t DNSType) (res *Response, err error) {
+	_, err = m.Do(ctx, func(r *Resolver) (err error) {
+		res, err = r.LookupResponse(ctx, fqdn, t)
+		return
+	})
+	return
+}
+
+// LookupIP performs DoH lookups on the A and AAAA records for the given FQDN,
+// bounded by the given context, with each of m's resolvers in order until one
+// succeeds. See Resolver.LookupIP for the results, and Do for the errors.
+func (m *MultiResolver) LookupIP(ctx context.Context, fqdn string) (ips []net.IP, ttls []uint32, err error) {
+	_, err = m.Do(ctx, func(r *Resolver) (err error) {
+		ips, ttls, err = r.LookupIP(ctx, fqdn)
+		return
+	})
+	return
+}
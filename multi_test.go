@@ -0,0 +1,194 @@
+package doh
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFailingResolver returns a resolver which server responds to every query
+// with a HTTP 503 Service Unavailable code.
+func newFailingResolver(host string) *Resolver {
+	r := newStubResolver(nil)
+	r.Host = host
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	})
+	return r
+}
+
+func TestMultiResolverDo(t *testing.T) {
+	answering := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+	answering.Host = "second.example.com"
+
+	m := &MultiResolver{
+		Resolvers: []*Resolver{
+			newFailingResolver("first.example.com"),
+			answering,
+			newFailingResolver("third.example.com"),
+		},
+	}
+
+	var recs []*ARecord
+	ctx := context.Background()
+	r, err := m.Do(ctx, func(r *Resolver) (err error) {
+		recs, _, err = r.LookupACtx(ctx, "brendan.abolivier.bzh")
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Host != "second.example.com" {
+		t.Errorf("expected second.example.com to answer, got %s", r.Host)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA {
+		t.Fail()
+	}
+}
+
+func TestMultiResolverDoFailure(t *testing.T) {
+	m := new(MultiResolver)
+	if _, err := m.Do(context.Background(), func(*Resolver) error { return nil }); err != ErrNoResolver {
+		t.Fail()
+	}
+
+	m.Resolvers = []*Resolver{newFailingResolver("first.example.com")}
+	r, err := m.Do(context.Background(), func(r *Resolver) (err error) {
+		_, _, err = r.LookupA("brendan.abolivier.bzh")
+		return
+	})
+	if r != nil || err == nil {
+		t.Fail()
+	}
+}
+
+func TestMultiResolverLookup(t *testing.T) {
+	answering := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+
+	m := &MultiResolver{
+		Resolvers: []*Resolver{newFailingResolver("first.example.com"), answering},
+	}
+
+	recs, ttls, err := m.Lookup(context.Background(), "brendan.abolivier.bzh", A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].(*ARecord).IP4 != expectedA || ttls[0] != 300 {
+		t.Fail()
+	}
+}
+
+func TestMultiResolverErrors(t *testing.T) {
+	m := &MultiResolver{
+		Resolvers: []*Resolver{
+			newFailingResolver("first.example.com"),
+			newFailingResolver("second.example.com"),
+		},
+	}
+
+	_, _, err := m.Lookup(context.Background(), "brendan.abolivier.bzh", A)
+	errs, ok := err.(ResolverErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if errs[0].Host != "first.example.com" || errs[1].Host != "second.example.com" {
+		t.Fail()
+	}
+}
+
+func TestMultiResolverErrorsMatch(t *testing.T) {
+	nxdomain := func(host string) *Resolver {
+		r := newStubResolver(func(q []byte) []byte {
+			res := buildResponse(q)
+			res[3] |= 3
+			return res
+		})
+		r.Host = host
+		return r
+	}
+
+	m := &MultiResolver{
+		Resolvers: []*Resolver{
+			newFailingResolver("first.example.com"),
+			nxdomain("second.example.com"),
+		},
+	}
+
+	// The errors of the lookups can be matched against the aggregate.
+	_, _, err := m.Lookup(context.Background(), "brendan.abolivier.bzh", A)
+	if !errors.Is(err, ErrNameError) {
+		t.Errorf("expected ErrNameError in %v", err)
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a *HTTPError in %v", err)
+	}
+
+	if errors.Is(err, ErrServerFailure) {
+		t.Errorf("unexpected ErrServerFailure in %v", err)
+	}
+}
+
+func TestMultiResolverDeadline(t *testing.T) {
+	r := newStubResolver(nil)
+	// Simulate a server that never replies.
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The deadline expires during the lookup with the last resolver.
+	m := &MultiResolver{Resolvers: []*Resolver{r}}
+	if _, _, err := m.Lookup(ctx, "brendan.abolivier.bzh", A); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestMultiResolverStopOnNameError(t *testing.T) {
+	nxdomain := newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q)
+		res[3] |= 3
+		return res
+	})
+	nxdomain.Host = "first.example.com"
+
+	queried := false
+	answering := newStubResolver(func(q []byte) []byte {
+		queried = true
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+
+	m := &MultiResolver{Resolvers: []*Resolver{nxdomain, answering}}
+
+	// Without StopOnNameError, the next resolver is tried.
+	if _, _, err := m.Lookup(context.Background(), "brendan.abolivier.bzh", A); err != nil || !queried {
+		t.Fail()
+	}
+
+	queried = false
+	m.StopOnNameError = true
+	_, _, err := m.Lookup(context.Background(), "brendan.abolivier.bzh", A)
+	if !errors.Is(err, ErrNameError) || queried {
+		t.Fail()
+	}
+}
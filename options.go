@@ -0,0 +1,74 @@
+package doh
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultHTTPTimeout is the timeout of the HTTP client of resolvers created
+// with NewResolver, unless another client is provided, and of the one used by
+// resolvers without a HTTP client.
+const DefaultHTTPTimeout = 10 * time.Second
+
+// Option configures a Resolver created with NewResolver.
+type Option func(r *Resolver)
+
+// WithClass sets the DNS class the resolver looks up with.
+func WithClass(c DNSClass) Option {
+	return func(r *Resolver) {
+		r.Class = c
+	}
+}
+
+// WithHTTPClient sets the http.Client the resolver sends its DoH requests
+// with.
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Resolver) {
+		r.HTTPClient = client
+	}
+}
+
+// WithTimeout bounds the time each individual DoH query can take, by setting
+// the resolver's QueryTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(r *Resolver) {
+		r.QueryTimeout = d
+	}
+}
+
+// NewResolver returns a resolver sending its DoH requests to the given host,
+// configured with the given options.
+// Unless overridden by an option, the resolver looks up with the IN class and
+// uses a http.Client with a timeout of DefaultHTTPTimeout.
+// If host is empty, every lookup with the resolver fails with ErrNoHost.
+func NewResolver(host string, opts ...Option) *Resolver {
+	r := &Resolver{
+		Host:       host,
+		Class:      IN,
+		HTTPClient: &http.Client{Timeout: DefaultHTTPTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// CloudflareResolver returns a resolver using Cloudflare's public DoH service,
+// configured with the given options.
+func CloudflareResolver(opts ...Option) *Resolver {
+	return NewResolver("cloudflare-dns.com", opts...)
+}
+
+// GoogleResolver returns a resolver using Google's public DoH service,
+// configured with the given options.
+func GoogleResolver(opts ...Option) *Resolver {
+	return NewResolver("dns.google", opts...)
+}
+
+// Quad9Resolver returns a resolver using Quad9's public DoH service, configured
+// with the given options.
+func Quad9Resolver(opts ...Option) *Resolver {
+	return NewResolver("dns.quad9.net", opts...)
+}
@@ -0,0 +1,51 @@
+package doh
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewResolver(t *testing.T) {
+	r := NewResolver("doh.example.com")
+	if r.Host != "doh.example.com" || r.Class != IN {
+		t.Fail()
+	}
+
+	if r.HTTPClient == nil || r.HTTPClient.Timeout != DefaultHTTPTimeout {
+		t.Fail()
+	}
+}
+
+func TestNewResolverOptions(t *testing.T) {
+	client := new(http.Client)
+	r := NewResolver(
+		"doh.example.com",
+		WithClass(CH),
+		WithHTTPClient(client),
+		WithTimeout(time.Second),
+	)
+
+	if r.Class != CH || r.HTTPClient != client || r.QueryTimeout != time.Second {
+		t.Fail()
+	}
+}
+
+func TestNewResolverNoHost(t *testing.T) {
+	r := NewResolver("")
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrNoHost {
+		t.Fail()
+	}
+}
+
+func TestPresets(t *testing.T) {
+	for _, r := range []*Resolver{CloudflareResolver(), GoogleResolver(), Quad9Resolver()} {
+		if len(r.Host) == 0 || r.Class != IN || r.HTTPClient == nil {
+			t.Errorf("unexpected preset %+v", r)
+		}
+	}
+
+	if r := GoogleResolver(WithTimeout(time.Second)); r.QueryTimeout != time.Second {
+		t.Fail()
+	}
+}
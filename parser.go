@@ -3,6 +3,7 @@ package doh
 import (
 	"encoding/binary"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -14,11 +15,18 @@ type parser struct {
 	// properly parse domain names when compressed as described in section 4.1.4
 	// of RFC 1035.
 	res []byte
+	// normalizeNames, when true, makes the parser return the names from
+	// records (i.e. their owner names and the names in their RDATA)
+	// lowercased and with a trailing dot.
+	normalizeNames bool
 }
 
 // parse is a generic function which calls the right function for a given DNS
 // type in order to parse an answer's data.
-func (p *parser) parse(t DNSType, c DNSClass, rdata []byte) interface{} {
+// Returns nil if the type isn't supported (or is only supported in another
+// class, e.g. A records outside of the IN class), or an error if the data
+// couldn't be parsed.
+func (p *parser) parse(t DNSType, c DNSClass, rdata []byte) (Record, error) {
 	// Types compatible with all classes.
 	switch t {
 	case CNAME:
@@ -35,6 +43,40 @@ func (p *parser) parse(t DNSType, c DNSClass, rdata []byte) interface{} {
 		return p.parseSOA(rdata)
 	case PTR:
 		return p.parsePTR(rdata)
+	case MB:
+		return p.parseMB(rdata)
+	case MG:
+		return p.parseMG(rdata)
+	case MR:
+		return p.parseMR(rdata)
+	case CAA:
+		return p.parseCAA(rdata)
+	case NAPTR:
+		return p.parseNAPTR(rdata)
+	case TLSA:
+		return p.parseTLSA(rdata)
+	case SSHFP:
+		return p.parseSSHFP(rdata)
+	case DS:
+		return p.parseDS(rdata)
+	case RRSIG:
+		return p.parseRRSIG(rdata)
+	case DNSKEY:
+		return p.parseDNSKEY(rdata)
+	case URI:
+		return p.parseURI(rdata)
+	case DNAME:
+		return p.parseDNAME(rdata)
+	case SPF:
+		return p.parseSPF(rdata)
+	case SVCB:
+		return p.parseSVCB(rdata)
+	case HTTPS:
+		svcb, err := p.parseSVCB(rdata)
+		if err != nil {
+			return nil, err
+		}
+		return &HTTPSRecord{SVCBRecord: *svcb}, nil
 	}
 
 	// Internet-specific types.
@@ -47,11 +89,11 @@ func (p *parser) parse(t DNSType, c DNSClass, rdata []byte) interface{} {
 		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 // parseA parses A records.
-func (p *parser) parseA(rdata []byte) *ARecord {
+func (p *parser) parseA(rdata []byte) (*ARecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -60,6 +102,10 @@ func (p *parser) parseA(rdata []byte) *ARecord {
 		|                                               |
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
+	if len(rdata) != 4 {
+		return nil, ErrCorrupted
+	}
+
 	var ip []string
 	for i := 0; i < len(rdata); i++ {
 		ip = append(ip, strconv.Itoa(int(rdata[i])))
@@ -67,12 +113,13 @@ func (p *parser) parseA(rdata []byte) *ARecord {
 
 	a := new(ARecord)
 	a.IP4 = strings.Join(ip, ".")
+	a.IP = net.IPv4(rdata[0], rdata[1], rdata[2], rdata[3])
 
-	return a
+	return a, nil
 }
 
 // parseAAAA parses AAAA records.
-func (p *parser) parseAAAA(rdata []byte) *AAAARecord {
+func (p *parser) parseAAAA(rdata []byte) (*AAAARecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -87,6 +134,10 @@ func (p *parser) parseAAAA(rdata []byte) *AAAARecord {
 		|                                               |
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
+	if len(rdata) != 16 {
+		return nil, ErrCorrupted
+	}
+
 	var ip []string
 	for i := 0; i < len(rdata); i += 2 {
 		ip = append(ip, fmt.Sprintf("%x", binary.BigEndian.Uint16(rdata[i:i+2])))
@@ -95,12 +146,14 @@ func (p *parser) parseAAAA(rdata []byte) *AAAARecord {
 	// TODO: Compress e.g. a:0:0:0:b into a::b
 	aaaa := new(AAAARecord)
 	aaaa.IP6 = strings.Join(ip, ":")
+	aaaa.IP = make(net.IP, net.IPv6len)
+	copy(aaaa.IP, rdata)
 
-	return aaaa
+	return aaaa, nil
 }
 
 // parseCNAME parses CNAME records.
-func (p *parser) parseCNAME(rdata []byte) *CNAMERecord {
+func (p *parser) parseCNAME(rdata []byte) (*CNAMERecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -110,13 +163,17 @@ func (p *parser) parseCNAME(rdata []byte) *CNAMERecord {
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
 	cname := new(CNAMERecord)
-	cname.CNAME, _ = p.parseName(rdata)
+	var err error
+	cname.CNAME, _, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
 
-	return cname
+	return cname, nil
 }
 
 // parseMX parses MX records.
-func (p *parser) parseMX(rdata []byte) *MXRecord {
+func (p *parser) parseMX(rdata []byte) (*MXRecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -127,15 +184,23 @@ func (p *parser) parseMX(rdata []byte) *MXRecord {
 		/                                               /
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
+	if len(rdata) < 3 {
+		return nil, ErrCorrupted
+	}
+
 	mx := new(MXRecord)
 	mx.Pref = binary.BigEndian.Uint16(rdata[0:2])
-	mx.Host, _ = p.parseName(rdata[2:])
+	var err error
+	mx.Host, _, err = p.parseRecordName(rdata[2:])
+	if err != nil {
+		return nil, err
+	}
 
-	return mx
+	return mx, nil
 }
 
 // parseSRV parses SRV records.
-func (p *parser) parseSRV(rdata []byte) *SRVRecord {
+func (p *parser) parseSRV(rdata []byte) (*SRVRecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -149,16 +214,24 @@ func (p *parser) parseSRV(rdata []byte) *SRVRecord {
 		|                    TARGET                     |
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
+	if len(rdata) < 7 {
+		return nil, ErrCorrupted
+	}
+
 	srv := new(SRVRecord)
 	srv.Priority = binary.BigEndian.Uint16(rdata[0:2])
 	srv.Weight = binary.BigEndian.Uint16(rdata[2:4])
 	srv.Port = binary.BigEndian.Uint16(rdata[4:6])
-	srv.Target, _ = p.parseName(rdata[6:])
-	return srv
+	var err error
+	srv.Target, _, err = p.parseRecordName(rdata[6:])
+	if err != nil {
+		return nil, err
+	}
+	return srv, nil
 }
 
 // parseNS parses NS records.
-func (p *parser) parseNS(rdata []byte) *NSRecord {
+func (p *parser) parseNS(rdata []byte) (*NSRecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -168,12 +241,16 @@ func (p *parser) parseNS(rdata []byte) *NSRecord {
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
 	ns := new(NSRecord)
-	ns.Host, _ = p.parseName(rdata)
-	return ns
+	var err error
+	ns.Host, _, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
+	return ns, nil
 }
 
 // parseTXT parses TXT records.
-func (p *parser) parseTXT(rdata []byte) *TXTRecord {
+func (p *parser) parseTXT(rdata []byte) (*TXTRecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -184,16 +261,39 @@ func (p *parser) parseTXT(rdata []byte) *TXTRecord {
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
 
-	length := int(rdata[0])
+	strs, err := readCharacterStrings(rdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TXTRecord{TXT: strings.Join(strs, ""), Strings: strs}, nil
+}
+
+// readCharacterStrings reads the one or more character-strings the given RDATA
+// is made of, as in TXT records.
+// Returns ErrCorrupted if the RDATA is empty or a character-string overflows
+// it.
+func readCharacterStrings(rdata []byte) ([]string, error) {
+	if len(rdata) < 1 {
+		return nil, ErrCorrupted
+	}
 
-	txt := new(TXTRecord)
-	txt.TXT = string(rdata[1 : length+1])
+	var strs []string
+	for len(rdata) > 0 {
+		str, offset, err := readCharacterString(rdata)
+		if err != nil {
+			return nil, err
+		}
+
+		strs = append(strs, str)
+		rdata = rdata[offset:]
+	}
 
-	return txt
+	return strs, nil
 }
 
 // parseSOA parses SOA records.
-func (p *parser) parseSOA(rdata []byte) *SOARecord {
+func (p *parser) parseSOA(rdata []byte) (*SOARecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -221,25 +321,36 @@ func (p *parser) parseSOA(rdata []byte) *SOARecord {
 	*/
 
 	var offset int
+	var err error
 
 	soa := new(SOARecord)
-	soa.PrimaryNS, offset = p.parseName(rdata)
+	soa.PrimaryNS, offset, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
 	rdata = rdata[offset:]
 
-	soa.RespMailbox, offset = p.parseName(rdata)
+	soa.RespMailbox, offset, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
 	rdata = rdata[offset:]
 
+	if len(rdata) < 20 {
+		return nil, ErrCorrupted
+	}
+
 	soa.Serial = binary.BigEndian.Uint32(rdata[0:4])
-	soa.Refresh = int32(binary.BigEndian.Uint32(rdata[4:8]))
-	soa.Retry = int32(binary.BigEndian.Uint32(rdata[8:12]))
-	soa.Expire = int32(binary.BigEndian.Uint32(rdata[12:16]))
+	soa.Refresh = binary.BigEndian.Uint32(rdata[4:8])
+	soa.Retry = binary.BigEndian.Uint32(rdata[8:12])
+	soa.Expire = binary.BigEndian.Uint32(rdata[12:16])
 	soa.Minimum = binary.BigEndian.Uint32(rdata[16:20])
 
-	return soa
+	return soa, nil
 }
 
 // parsePTR parses PTR records.
-func (p *parser) parsePTR(rdata []byte) *PTRRecord {
+func (p *parser) parsePTR(rdata []byte) (*PTRRecord, error) {
 	/*
 		                               1  1  1  1  1  1
 		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -249,18 +360,485 @@ func (p *parser) parsePTR(rdata []byte) *PTRRecord {
 	*/
 
 	ptr := new(PTRRecord)
-	ptr.PTR, _ = p.parseName(rdata)
+	var err error
+	ptr.PTR, _, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return ptr, nil
+}
+
+// parseMB parses MB records.
+func (p *parser) parseMB(rdata []byte) (*MBRecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                   MADNAME                     /
+		/                                               /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+
+	mb := new(MBRecord)
+	var err error
+	mb.Name, _, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return mb, nil
+}
+
+// parseMG parses MG records.
+func (p *parser) parseMG(rdata []byte) (*MGRecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                   MGMNAME                     /
+		/                                               /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+
+	mg := new(MGRecord)
+	var err error
+	mg.Name, _, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return mg, nil
+}
+
+// parseMR parses MR records.
+func (p *parser) parseMR(rdata []byte) (*MRRecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                   NEWNAME                     /
+		/                                               /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+
+	mr := new(MRRecord)
+	var err error
+	mr.Name, _, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return mr, nil
+}
+
+// parseCAA parses CAA records.
+func (p *parser) parseCAA(rdata []byte) (*CAARecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|         FLAGS         |      TAG LENGTH       |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                      TAG                      /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                     VALUE                     /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+
+	if len(rdata) < 2 || int(rdata[1])+2 > len(rdata) {
+		return nil, ErrCorrupted
+	}
+
+	length := int(rdata[1])
+
+	caa := new(CAARecord)
+	caa.Flag = rdata[0]
+	caa.Tag = string(rdata[2 : length+2])
+	caa.Value = string(rdata[length+2:])
+
+	return caa, nil
+}
+
+// parseNAPTR parses NAPTR records, as described in section 4.1 of RFC 3403.
+func (p *parser) parseNAPTR(rdata []byte) (*NAPTRRecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                     ORDER                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                   PREFERENCE                  |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                     FLAGS                     /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                   SERVICES                    /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                    REGEXP                     /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                  REPLACEMENT                  /
+		/                                               /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	if len(rdata) < 4 {
+		return nil, ErrCorrupted
+	}
+
+	naptr := new(NAPTRRecord)
+	naptr.Order = binary.BigEndian.Uint16(rdata[0:2])
+	naptr.Preference = binary.BigEndian.Uint16(rdata[2:4])
+
+	b := rdata[4:]
+	for _, field := range []*string{&naptr.Flags, &naptr.Service, &naptr.Regexp} {
+		str, offset, err := readCharacterString(b)
+		if err != nil {
+			return nil, err
+		}
+		*field = str
+		b = b[offset:]
+	}
+
+	var err error
+	naptr.Replacement, _, err = p.parseRecordName(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return naptr, nil
+}
+
+// parseTLSA parses TLSA records, as described in section 2.1 of RFC 6698.
+func (p *parser) parseTLSA(rdata []byte) (*TLSARecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|     CERT USAGE        |       SELECTOR        |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|    MATCHING TYPE      |                       /
+		+--+--+--+--+--+--+--+--+                       /
+		/         CERTIFICATE ASSOCIATION DATA          /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	if len(rdata) < 3 {
+		return nil, ErrCorrupted
+	}
+
+	tlsa := new(TLSARecord)
+	tlsa.Usage = rdata[0]
+	tlsa.Selector = rdata[1]
+	tlsa.MatchingType = rdata[2]
+	tlsa.Certificate = make([]byte, len(rdata)-3)
+	copy(tlsa.Certificate, rdata[3:])
 
-	return ptr
+	return tlsa, nil
 }
 
+// parseSSHFP parses SSHFP records, as described in section 3.1 of RFC 4255.
+func (p *parser) parseSSHFP(rdata []byte) (*SSHFPRecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|       ALGORITHM       |        FP TYPE        |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                  FINGERPRINT                  /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	if len(rdata) < 2 {
+		return nil, ErrCorrupted
+	}
+
+	sshfp := new(SSHFPRecord)
+	sshfp.Algorithm = rdata[0]
+	sshfp.Type = rdata[1]
+	sshfp.Fingerprint = make([]byte, len(rdata)-2)
+	copy(sshfp.Fingerprint, rdata[2:])
+
+	return sshfp, nil
+}
+
+// parseDS parses DS records, as described in section 5.1 of RFC 4034.
+func (p *parser) parseDS(rdata []byte) (*DSRecord, error) {
+	/*
+		                     1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+		 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|           Key Tag             |  Algorithm    |  Digest Type  |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		/                                                               /
+		/                            Digest                             /
+		/                                                               /
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	*/
+	if len(rdata) < 4 {
+		return nil, ErrCorrupted
+	}
+
+	ds := new(DSRecord)
+	ds.KeyTag = binary.BigEndian.Uint16(rdata[0:2])
+	ds.Algorithm = rdata[2]
+	ds.DigestType = rdata[3]
+	ds.Digest = make([]byte, len(rdata)-4)
+	copy(ds.Digest, rdata[4:])
+
+	return ds, nil
+}
+
+// parseRRSIG parses RRSIG records, as described in section 3.1 of RFC 4034.
+func (p *parser) parseRRSIG(rdata []byte) (*RRSIGRecord, error) {
+	/*
+		                     1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+		 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|        Type Covered           |  Algorithm    |     Labels    |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                         Original TTL                          |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      Signature Expiration                     |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|                      Signature Inception                      |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|            Key Tag            |                               /
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+         Signer's Name         /
+		/                                                               /
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		/                                                               /
+		/                            Signature                          /
+		/                                                               /
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	*/
+	if len(rdata) < 18 {
+		return nil, ErrCorrupted
+	}
+
+	sig := new(RRSIGRecord)
+	sig.TypeCovered = DNSType(binary.BigEndian.Uint16(rdata[0:2]))
+	sig.Algorithm = rdata[2]
+	sig.Labels = rdata[3]
+	sig.OriginalTTL = binary.BigEndian.Uint32(rdata[4:8])
+	sig.Expiration = binary.BigEndian.Uint32(rdata[8:12])
+	sig.Inception = binary.BigEndian.Uint32(rdata[12:16])
+	sig.KeyTag = binary.BigEndian.Uint16(rdata[16:18])
+
+	name, offset, err := p.parseRecordName(rdata[18:])
+	if err != nil {
+		return nil, err
+	}
+
+	sig.SignerName = name
+	sig.Signature = make([]byte, len(rdata)-18-offset)
+	copy(sig.Signature, rdata[18+offset:])
+
+	return sig, nil
+}
+
+// parseDNSKEY parses DNSKEY records, as described in section 2.1 of RFC 4034.
+func (p *parser) parseDNSKEY(rdata []byte) (*DNSKEYRecord, error) {
+	/*
+		                     1 1 1 1 1 1 1 1 1 1 2 2 2 2 2 2 2 2 2 2 3 3
+		 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		|              Flags            |    Protocol   |   Algorithm   |
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		/                                                               /
+		/                            Public Key                         /
+		/                                                               /
+		+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	*/
+	if len(rdata) < 4 {
+		return nil, ErrCorrupted
+	}
+
+	key := new(DNSKEYRecord)
+	key.Flags = binary.BigEndian.Uint16(rdata[0:2])
+	key.Protocol = rdata[2]
+	key.Algorithm = rdata[3]
+	key.PublicKey = make([]byte, len(rdata)-4)
+	copy(key.PublicKey, rdata[4:])
+
+	return key, nil
+}
+
+// parseURI parses URI records, as described in section 4.5 of RFC 7553.
+func (p *parser) parseURI(rdata []byte) (*URIRecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                   PRIORITY                    |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                    WEIGHT                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                    TARGET                     /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	if len(rdata) < 4 {
+		return nil, ErrCorrupted
+	}
+
+	uri := new(URIRecord)
+	uri.Priority = binary.BigEndian.Uint16(rdata[0:2])
+	uri.Weight = binary.BigEndian.Uint16(rdata[2:4])
+	// The target is neither a domain name nor a character-string, but takes
+	// up the rest of the RDATA.
+	uri.Target = string(rdata[4:])
+
+	return uri, nil
+}
+
+// parseDNAME parses DNAME records, which RDATA has the same format as the RDATA
+// of CNAME records, as described in section 2.1 of RFC 6672.
+func (p *parser) parseDNAME(rdata []byte) (*DNAMERecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                    TARGET                     /
+		/                                               /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	dname := new(DNAMERecord)
+	var err error
+	dname.Target, _, err = p.parseRecordName(rdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return dname, nil
+}
+
+// parseSPF parses SPF records, which RDATA has the same format as the RDATA of
+// TXT records.
+func (p *parser) parseSPF(rdata []byte) (*SPFRecord, error) {
+	strs, err := readCharacterStrings(rdata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SPFRecord{SPF: strings.Join(strs, ""), Strings: strs}, nil
+}
+
+// parseSVCB parses SVCB records, as well as HTTPS records which share the same
+// format, as described in section 2.2 of RFC 9460.
+func (p *parser) parseSVCB(rdata []byte) (*SVCBRecord, error) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                  SVCPRIORITY                  |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                  TARGETNAME                   /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                   SVCPARAMS                   /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+
+		With each SvcParam being:
+
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                 SVCPARAMKEY                   |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                    LENGTH                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                SVCPARAMVALUE                  /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	if len(rdata) < 3 {
+		return nil, ErrCorrupted
+	}
+
+	svcb := new(SVCBRecord)
+	svcb.Priority = binary.BigEndian.Uint16(rdata[0:2])
+
+	var offset int
+	var err error
+	svcb.Target, offset, err = p.parseRecordName(rdata[2:])
+	if err != nil {
+		return nil, err
+	}
+	rdata = rdata[2+offset:]
+
+	svcb.Params = make(map[uint16][]byte)
+	lastKey := -1
+	for len(rdata) > 0 {
+		if len(rdata) < 4 {
+			return nil, ErrCorrupted
+		}
+
+		key := binary.BigEndian.Uint16(rdata[0:2])
+		length := int(binary.BigEndian.Uint16(rdata[2:4]))
+		// Section 2.2 of RFC 9460 requires keys to be in strictly increasing
+		// order, and records that don't follow it to be considered malformed.
+		if int(key) <= lastKey || len(rdata) < length+4 {
+			return nil, ErrCorrupted
+		}
+
+		svcb.Params[key] = rdata[4 : length+4]
+		lastKey = int(key)
+		rdata = rdata[length+4:]
+	}
+
+	return svcb, nil
+}
+
+// readCharacterString reads the <character-string> as defined in section 3.3 of
+// RFC 1035, i.e. a length byte followed by that many bytes, at the start of
+// the given buffer.
+// Returns the string, as well as the number of bytes it takes in the buffer.
+// Returns ErrCorrupted if the string is incomplete.
+func readCharacterString(b []byte) (str string, offset int, err error) {
+	if len(b) < 1 || int(b[0])+1 > len(b) {
+		return "", 0, ErrCorrupted
+	}
+
+	length := int(b[0])
+	return string(b[1 : length+1]), length + 1, nil
+}
+
+// maxPointerJumps is the maximum number of compression pointers a domain name
+// can be made of, in order to detect pointers forming a loop. A name can't be
+// longer than 255 bytes, and every pointer (except the last one) must be
+// preceded by at least one label, so no valid name needs more than that.
+const maxPointerJumps = 128
+
 // parseName parses a domain name as described in the QNAME definition of
 // section 4.1.2 of RFC 1035, with support for compression.
 // Returns the domain name with points as the separator between labels, as well
 // as the number of bytes the name represents in the payload it's been given.
-func (p *parser) parseName(b []byte) (name string, offset int) {
+// Returns ErrCorrupted if the name is incomplete, or if it contains an invalid
+// compression pointer, i.e. one that points outside of the message or that is
+// part of a loop.
+func (p *parser) parseName(b []byte) (name string, offset int, err error) {
+	return p.parseNameJumps(b, 0)
+}
+
+// parseRecordName is the same as parseName, but for names from records, which
+// it returns normalized with recordName.
+func (p *parser) parseRecordName(b []byte) (name string, offset int, err error) {
+	name, offset, err = p.parseName(b)
+	return p.recordName(name), offset, err
+}
+
+// recordName returns the given name from a record the way the parser returns
+// it, i.e. lowercased and with a trailing dot if p.normalizeNames is true, or
+// unchanged otherwise.
+func (p *parser) recordName(name string) string {
+	if !p.normalizeNames {
+		return name
+	}
+
+	return strings.ToLower(name) + "."
+}
+
+// parseNameJumps is the same as parseName, but takes the number of compression
+// pointers that have been followed to reach the given payload.
+func (p *parser) parseNameJumps(b []byte, jumps int) (name string, offset int, err error) {
 	var labels []string
 	for {
+		if offset >= len(b) {
+			return "", 0, ErrCorrupted
+		}
+
 		length := int(b[offset])
 		// A length of 0 means we've reached the end of the domain name.
 		if length == 0 {
@@ -271,11 +849,22 @@ func (p *parser) parseName(b []byte) (name string, offset int) {
 		// If the two most significant bits of the first byte are both 1, it
 		// means compression is used for the rest of the domain name.
 		if length>>6 == 3 {
+			if offset+2 > len(b) || jumps >= maxPointerJumps {
+				return "", 0, ErrCorrupted
+			}
+
 			// 16383 is b10 for b2 00111111 11111111, which matches with the
 			// pointer to the next labels without the two "11" most significant
 			// bits.
-			ptr := binary.BigEndian.Uint16(b[offset:offset+2]) & 16383
-			label, _ := p.parseName(p.res[ptr:])
+			ptr := int(binary.BigEndian.Uint16(b[offset:offset+2]) & 16383)
+			if ptr >= len(p.res) {
+				return "", 0, ErrCorrupted
+			}
+
+			label, _, err := p.parseNameJumps(p.res[ptr:], jumps+1)
+			if err != nil {
+				return "", 0, err
+			}
 			labels = append(labels, label)
 			offset += 2
 			// RFC says the pointer points to "an entire domain name or a list
@@ -283,11 +872,15 @@ func (p *parser) parseName(b []byte) (name string, offset int) {
 			// that's the end of the name.
 			break
 		} else {
+			if offset+length+1 > len(b) {
+				return "", 0, ErrCorrupted
+			}
+
 			labels = append(labels, string(b[offset+1:offset+length+1]))
 			offset += length + 1
 		}
 
 	}
 
-	return strings.Join(labels, "."), offset
+	return strings.Join(labels, "."), offset, nil
 }
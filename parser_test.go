@@ -2,7 +2,10 @@ package doh
 
 import (
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"reflect"
 	"testing"
 )
@@ -26,6 +29,10 @@ const rdataNS = "BW5zMjAwB2FueWNhc3QCbWUA"
 const expectedNSHost = "ns200.anycast.me"
 const rdataTXT = "HzR8aHR0cHM6Ly9icmVuZGFuLmFib2xpdmllci5iemg"
 const expectedTXT = "4|https://brendan.abolivier.bzh"
+
+const rdataTXTMulti = "GXY9c3BmMSBpbmNsdWRlOm14Lm92aC5jb20FIH5hbGw"
+const expectedTXTMultiFirst = "v=spf1 include:mx.ovh.com"
+const expectedTXTMultiSecond = " ~all"
 const rdataSOA = "BmRuczIwMAdhbnljYXN0Am1lAAR0ZWNoA292aANuZXQAeFfPoAABUYAAAA4QADbugAAAASw"
 const expectedSOAPrimaryNS = "dns200.anycast.me"
 const expectedSOARespMailbox = "tech.ovh.net"
@@ -36,6 +43,87 @@ const expectedSOAExpire = 3600000
 const expectedSOAMinimum = 300
 const rdataPTR = "BmFyYWdvZxBicmVuZGFuYWJvbGl2aWVyA2NvbQA"
 const expectedPTR = "aragog.brendanabolivier.com"
+const rdataMB = "BG1haWwJYWJvbGl2aWVyA2J6aAA"
+const expectedMB = "mail.abolivier.bzh"
+const rdataMG = "CnBvc3RtYXN0ZXIJYWJvbGl2aWVyA2J6aAA"
+const expectedMG = "postmaster.abolivier.bzh"
+const rdataMR = "B25ld21haWwJYWJvbGl2aWVyA2J6aAA"
+const expectedMR = "newmail.abolivier.bzh"
+const rdataCAA = "AAVpc3N1ZWxldHNlbmNyeXB0Lm9yZw"
+const expectedCAAFlag = 0
+const expectedCAATag = "issue"
+const expectedCAAValue = "letsencrypt.org"
+
+// NAPTR record: 100 10 "S" "SIP+D2U" "" _sip._udp.example.com
+const rdataNAPTR = "AGQACgFTB1NJUCtEMlUABF9zaXAEX3VkcAdleGFtcGxlA2NvbQA"
+const expectedNAPTROrder = 100
+const expectedNAPTRPreference = 10
+const expectedNAPTRFlags = "S"
+const expectedNAPTRService = "SIP+D2U"
+const expectedNAPTRRegexp = ""
+const expectedNAPTRReplacement = "_sip._udp.example.com"
+
+// TLSA record: 3 1 1 followed by the SHA-256 digest of "brendan.abolivier.bzh"
+const rdataTLSA = "AwEBpyXZBMTJ3vdN7wKOoPdvIeTBRYjilMQdGyfVeR4s+7s"
+const expectedTLSAUsage = 3
+const expectedTLSASelector = 1
+const expectedTLSAMatchingType = 1
+const expectedTLSACertificate = "a725d904c4c9def74def028ea0f76f21e4c14588e294c41d1b27d5791e2cfbbb"
+
+// SSHFP record: 4 2 followed by the SHA-256 digest of "ssh-ed25519 brendan"
+const rdataSSHFP = "BAIAW7ZD1p2beyFuKjXPUcWkPa1+rpmf3RCz8ejmLN3PLg"
+const expectedSSHFPAlgorithm = 4
+const expectedSSHFPType = 2
+const expectedSSHFPFingerprint = "005bb643d69d9b7b216e2a35cf51c5a43dad7eae999fdd10b3f1e8e62cddcf2e"
+
+// DS record: 2371 13 2 followed by the SHA-256 digest of "cloudflare.com"
+const rdataDS = "CUMNAgZ6P/eRhjQXUi+RQiSlVKiQeNM8mg+JDLb1QUOegchI"
+const expectedDSKeyTag = 2371
+const expectedDSAlgorithm = 13
+const expectedDSDigestType = 2
+const expectedDSDigest = "067a3ff791863417522f914224a554a89078d33c9a0f890cb6f541439e81c848"
+
+// RRSIG record: A 13 2 300 20261015000000 20261013000000 34505 cloudflare.com
+// followed by the bytes 1 to 32 as the signature
+const rdataRRSIG = "AAENAgAAASxq0BeAas10gIbJCmNsb3VkZmxhcmUDY29tAAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8g"
+const expectedRRSIGLabels = 2
+const expectedRRSIGOriginalTTL = 300
+const expectedRRSIGKeyTag = 34505
+const expectedRRSIGSignerName = "cloudflare.com"
+const expectedRRSIGSignature = "AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA="
+
+// DNSKEY record: 257 3 13 followed by the SHA-512 digest of "cloudflare.com"
+const rdataDNSKEY = "AQEDDdm4xbb813Uc7jD6S3HZbQn3VM6T9oREOvkHDJpXjqIp4x2Qfl6cALaSmqhe/8QrXaLFw9wKOIYHd3BKylR32D4"
+const expectedDNSKEYFlags = 257
+const expectedDNSKEYProtocol = 3
+const expectedDNSKEYAlgorithm = 13
+const expectedDNSKEYPublicKey = "2bjFtvzXdRzuMPpLcdltCfdUzpP2hEQ6+QcMmleOoinjHZB+XpwAtpKaqF7/xCtdosXD3Ao4hgd3cErKVHfYPg=="
+
+// URI record: 10 1 "https://brendan.abolivier.bzh/"
+const rdataURI = "AAoAAWh0dHBzOi8vYnJlbmRhbi5hYm9saXZpZXIuYnpoLw"
+const expectedURIPriority = 10
+const expectedURIWeight = 1
+const expectedURITarget = "https://brendan.abolivier.bzh/"
+
+// DNAME record: example.net
+const rdataDNAME = "B2V4YW1wbGUDbmV0AA"
+const expectedDNAMETarget = "example.net"
+
+// SPF record: "v=spf1 include:mx.ovh.com" " ~all"
+const rdataSPF = "GXY9c3BmMSBpbmNsdWRlOm14Lm92aC5jb20FIH5hbGw"
+
+// HTTPS record for cloudflare.com: 1 . alpn=h3,h2 ipv4hint=104.16.132.229,
+// 104.16.133.229 ipv6hint=2606:4700::6810:84e5,2606:4700::6810:85e5
+const rdataHTTPS = "AAEAAAEABgJoMwJoMgAEAAhoEITlaBCF5QAGACAmBkcAAAAAAAAAAABoEITlJgZHAAAAAAAAAAAAaBCF5Q"
+const expectedHTTPSPriority = 1
+const expectedHTTPSTarget = ""
+const expectedHTTPSParams = 3
+
+// SVCB record: 16 svc.example.net alpn=h2 port=8443
+const rdataSVCB = "ABADc3ZjB2V4YW1wbGUDbmV0AAABAAMCaDIAAwACIPs"
+const expectedSVCBPriority = 16
+const expectedSVCBTarget = "svc.example.net"
+const expectedSVCBPort = 8443
 const name = "CWFib2xpdmllcgNiemgA"
 const expectedName = "abolivier.bzh"
 const expectedOffset = 15
@@ -50,6 +138,21 @@ func TestParseFlow(t *testing.T) {
 	testParseType(t, rdataTXT, "TXT", TXT)
 	testParseType(t, rdataSOA, "SOA", SOA)
 	testParseType(t, rdataPTR, "PTR", PTR)
+	testParseType(t, rdataMB, "MB", MB)
+	testParseType(t, rdataMG, "MG", MG)
+	testParseType(t, rdataMR, "MR", MR)
+	testParseType(t, rdataCAA, "CAA", CAA)
+	testParseType(t, rdataNAPTR, "NAPTR", NAPTR)
+	testParseType(t, rdataTLSA, "TLSA", TLSA)
+	testParseType(t, rdataSSHFP, "SSHFP", SSHFP)
+	testParseType(t, rdataDS, "DS", DS)
+	testParseType(t, rdataRRSIG, "RRSIG", RRSIG)
+	testParseType(t, rdataDNSKEY, "DNSKEY", DNSKEY)
+	testParseType(t, rdataURI, "URI", URI)
+	testParseType(t, rdataDNAME, "DNAME", DNAME)
+	testParseType(t, rdataSPF, "SPF", SPF)
+	testParseType(t, rdataSVCB, "SVCB", SVCB)
+	testParseType(t, rdataHTTPS, "HTTPS", HTTPS)
 	// Test that parse returns nil on unknown record type.
 	// We don't care about which rdata we feed this one with, since parse isn't
 	// expected to feed that rdata to an actual parsing function.
@@ -63,7 +166,10 @@ func testParseType(t *testing.T, b64, expectedType string, recordType DNSType) {
 	}
 
 	p := new(parser)
-	parsed := p.parse(recordType, ANYCLASS, rdata)
+	parsed, err := p.parse(recordType, ANYCLASS, rdata)
+	if err != nil {
+		t.FailNow()
+	}
 
 	if len(expectedType) > 0 {
 		expected := fmt.Sprintf("*doh.%sRecord", expectedType)
@@ -84,10 +190,16 @@ func TestParseA(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseA(rdata)
+	rec, err := p.parseA(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 	if rec.IP4 != expectedA {
 		t.Fail()
 	}
+	if !rec.IP.Equal(net.ParseIP(expectedA)) {
+		t.Fail()
+	}
 }
 
 func TestParseAAAA(t *testing.T) {
@@ -97,10 +209,16 @@ func TestParseAAAA(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseAAAA(rdata)
+	rec, err := p.parseAAAA(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 	if rec.IP6 != expectedAAAA {
 		t.Fail()
 	}
+	if !rec.IP.Equal(net.ParseIP(expectedAAAA)) || rec.IP.To4() != nil {
+		t.Fail()
+	}
 }
 
 func TestParseCNAME(t *testing.T) {
@@ -110,7 +228,10 @@ func TestParseCNAME(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseCNAME(rdata)
+	rec, err := p.parseCNAME(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 	if rec.CNAME != expectedCNAME {
 		t.Fail()
 	}
@@ -123,7 +244,10 @@ func TestParseMX(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseMX(rdata)
+	rec, err := p.parseMX(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 
 	if rec.Host != expectedMXHost {
 		t.Fail()
@@ -141,7 +265,10 @@ func TestParseSRV(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseSRV(rdata)
+	rec, err := p.parseSRV(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 	if rec.Priority != expectedSRVPriority {
 		t.Fail()
 	}
@@ -166,7 +293,10 @@ func TestParseNS(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseNS(rdata)
+	rec, err := p.parseNS(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 	if rec.Host != expectedNSHost {
 		t.Fail()
 	}
@@ -179,10 +309,61 @@ func TestParseTXT(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseTXT(rdata)
+	rec, err := p.parseTXT(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 	if rec.TXT != expectedTXT {
 		t.Fail()
 	}
+	if len(rec.Strings) != 1 || rec.Strings[0] != expectedTXT {
+		t.Fail()
+	}
+}
+
+func TestParseTXTMultipleStrings(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataTXTMulti)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseTXT(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+	if len(rec.Strings) != 2 ||
+		rec.Strings[0] != expectedTXTMultiFirst ||
+		rec.Strings[1] != expectedTXTMultiSecond {
+		t.Fail()
+	}
+	if rec.TXT != expectedTXTMultiFirst+expectedTXTMultiSecond {
+		t.Fail()
+	}
+
+	// Truncating the second string must fail.
+	if _, err := p.parseTXT(rdata[:len(rdata)-1]); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestReadCharacterString(t *testing.T) {
+	str, offset, err := readCharacterString([]byte{3, 'f', 'o', 'o', 3, 'b'})
+	if err != nil || str != "foo" || offset != 4 {
+		t.Fail()
+	}
+
+	// A length byte exceeding the available data must fail instead of
+	// panicking, in the helper as well as in the TXT parser.
+	for _, b := range [][]byte{{}, {4, 'f', 'o', 'o'}, {0xff, 'f', 'o', 'o'}} {
+		if _, _, err := readCharacterString(b); err != ErrCorrupted {
+			t.Errorf("unexpected error %v for %v", err, b)
+		}
+
+		if _, err := new(parser).parseTXT(b); err != ErrCorrupted {
+			t.Errorf("unexpected TXT error %v for %v", err, b)
+		}
+	}
 }
 
 func TestParseSOA(t *testing.T) {
@@ -192,7 +373,10 @@ func TestParseSOA(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parseSOA(rdata)
+	rec, err := p.parseSOA(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 
 	if rec.PrimaryNS != expectedSOAPrimaryNS {
 		t.Fail()
@@ -213,6 +397,22 @@ func TestParseSOA(t *testing.T) {
 	if rec.Retry != expectedSOARetry {
 		t.Fail()
 	}
+
+	if rec.Expire != expectedSOAExpire {
+		t.Fail()
+	}
+
+	if rec.Minimum != expectedSOAMinimum {
+		t.Fail()
+	}
+
+	// Time intervals are unsigned, so values with the most significant bit
+	// set must not be read as negative numbers.
+	binary.BigEndian.PutUint32(rdata[len(rdata)-8:len(rdata)-4], 0x80000000)
+	rec, err = p.parseSOA(rdata)
+	if err != nil || rec.Expire != 0x80000000 {
+		t.Fail()
+	}
 }
 
 func TestParsePTR(t *testing.T) {
@@ -222,12 +422,381 @@ func TestParsePTR(t *testing.T) {
 	}
 
 	p := new(parser)
-	rec := p.parsePTR(rdata)
+	rec, err := p.parsePTR(rdata)
+	if err != nil {
+		t.FailNow()
+	}
 	if rec.PTR != expectedPTR {
 		t.Fail()
 	}
 }
 
+func TestParseMB(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataMB)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseMB(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+	if rec.Name != expectedMB {
+		t.Fail()
+	}
+}
+
+func TestParseMG(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataMG)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseMG(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+	if rec.Name != expectedMG {
+		t.Fail()
+	}
+}
+
+func TestParseMR(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataMR)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseMR(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+	if rec.Name != expectedMR {
+		t.Fail()
+	}
+}
+
+func TestParseCAA(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataCAA)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseCAA(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Flag != expectedCAAFlag {
+		t.Fail()
+	}
+
+	if rec.Tag != expectedCAATag {
+		t.Fail()
+	}
+
+	if rec.Value != expectedCAAValue {
+		t.Fail()
+	}
+}
+
+func TestParseNAPTR(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataNAPTR)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseNAPTR(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Order != expectedNAPTROrder || rec.Preference != expectedNAPTRPreference {
+		t.Fail()
+	}
+
+	if rec.Flags != expectedNAPTRFlags ||
+		rec.Service != expectedNAPTRService ||
+		rec.Regexp != expectedNAPTRRegexp {
+		t.Fail()
+	}
+
+	if rec.Replacement != expectedNAPTRReplacement {
+		t.Fail()
+	}
+
+	// Truncating a character-string must fail.
+	if _, err := p.parseNAPTR(rdata[:6]); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestParseNAPTRCompressed(t *testing.T) {
+	// A message with example.com right after its header, and a NAPTR record
+	// whose replacement points to it.
+	res := append(make([]byte, DNSMsgHeaderLen), []byte("\x07example\x03com\x00")...)
+	rdata := []byte("\x00\x64\x00\x0a\x01S\x07SIP+D2U\x00\x04_sip\x04_udp\xc0\x0c")
+
+	p := &parser{res: res}
+	rec, err := p.parseNAPTR(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Replacement != expectedNAPTRReplacement {
+		t.Fail()
+	}
+}
+
+func TestParseTLSA(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataTLSA)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseTLSA(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Usage != expectedTLSAUsage ||
+		rec.Selector != expectedTLSASelector ||
+		rec.MatchingType != expectedTLSAMatchingType {
+		t.Fail()
+	}
+
+	if hex.EncodeToString(rec.Certificate) != expectedTLSACertificate {
+		t.Fail()
+	}
+}
+
+func TestParseSSHFP(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataSSHFP)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseSSHFP(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Algorithm != expectedSSHFPAlgorithm || rec.Type != expectedSSHFPType {
+		t.Fail()
+	}
+
+	if rec.FingerprintHex() != expectedSSHFPFingerprint {
+		t.Fail()
+	}
+}
+
+func TestParseDS(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataDS)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseDS(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.KeyTag != expectedDSKeyTag ||
+		rec.Algorithm != expectedDSAlgorithm ||
+		rec.DigestType != expectedDSDigestType {
+		t.Fail()
+	}
+
+	if hex.EncodeToString(rec.Digest) != expectedDSDigest {
+		t.Fail()
+	}
+
+	// Unknown algorithms and digest types must not be rejected.
+	rdata[2], rdata[3] = 250, 250
+	if _, err := p.parseDS(rdata); err != nil {
+		t.Fail()
+	}
+}
+
+func TestParseRRSIG(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataRRSIG)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseRRSIG(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.TypeCovered != A ||
+		rec.Algorithm != 13 ||
+		rec.Labels != expectedRRSIGLabels ||
+		rec.OriginalTTL != expectedRRSIGOriginalTTL ||
+		rec.KeyTag != expectedRRSIGKeyTag ||
+		rec.SignerName != expectedRRSIGSignerName {
+		t.Fail()
+	}
+
+	if base64.StdEncoding.EncodeToString(rec.Signature) != expectedRRSIGSignature {
+		t.Fail()
+	}
+
+	if _, err := p.parseRRSIG(rdata[:17]); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestParseDNSKEY(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataDNSKEY)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseDNSKEY(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Flags != expectedDNSKEYFlags ||
+		rec.Protocol != expectedDNSKEYProtocol ||
+		rec.Algorithm != expectedDNSKEYAlgorithm {
+		t.Fail()
+	}
+
+	if base64.StdEncoding.EncodeToString(rec.PublicKey) != expectedDNSKEYPublicKey {
+		t.Fail()
+	}
+
+	// Unknown algorithms must not be rejected.
+	rdata[3] = 250
+	if _, err := p.parseDNSKEY(rdata); err != nil {
+		t.Fail()
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataURI)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseURI(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Priority != expectedURIPriority || rec.Weight != expectedURIWeight {
+		t.Fail()
+	}
+
+	if rec.Target != expectedURITarget {
+		t.Fail()
+	}
+}
+
+func TestParseDNAME(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataDNAME)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseDNAME(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+	if rec.Target != expectedDNAMETarget {
+		t.Fail()
+	}
+
+	// The target can be compressed, e.g. when it's a parent of the owner.
+	p.res = append([]byte{0, 0}, rdata...)
+	rec, err = p.parseDNAME([]byte{0xc0, 2})
+	if err != nil || rec.Target != expectedDNAMETarget {
+		t.Fail()
+	}
+}
+
+func TestParseSPF(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataSPF)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseSPF(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.SPF != expectedTXTMultiFirst+expectedTXTMultiSecond {
+		t.Fail()
+	}
+
+	if !reflect.DeepEqual(rec.Strings, []string{expectedTXTMultiFirst, expectedTXTMultiSecond}) {
+		t.Fail()
+	}
+
+	if _, err := p.parseSPF(rdata[:len(rdata)-1]); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestParseHTTPS(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataHTTPS)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseSVCB(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Priority != expectedHTTPSPriority || rec.Target != expectedHTTPSTarget {
+		t.Fail()
+	}
+
+	if len(rec.Params) != expectedHTTPSParams {
+		t.Fail()
+	}
+}
+
+func TestParseSVCB(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataSVCB)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseSVCB(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	if rec.Priority != expectedSVCBPriority || rec.Target != expectedSVCBTarget {
+		t.Fail()
+	}
+
+	// Truncating the last parameter must fail.
+	if _, err := p.parseSVCB(rdata[:len(rdata)-1]); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
 func TestParseName(t *testing.T) {
 	b, err := base64.RawStdEncoding.DecodeString(name)
 	if err != nil {
@@ -235,8 +804,41 @@ func TestParseName(t *testing.T) {
 	}
 
 	p := new(parser)
-	n, o := p.parseName(b)
-	if n != expectedName || o != expectedOffset {
+	n, o, err := p.parseName(b)
+	if err != nil || n != expectedName || o != expectedOffset {
 		t.Fail()
 	}
 }
+
+func TestParseNameTruncated(t *testing.T) {
+	b, err := base64.RawStdEncoding.DecodeString(name)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	if _, _, err := p.parseName(b[:5]); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestTruncatedRDATA(t *testing.T) {
+	// Parsing records cut at any byte must fail cleanly instead of panicking.
+	for rtype, b64 := range map[DNSType]string{
+		A: rdataA, AAAA: rdataAAAA, CNAME: rdataCNAME, MX: rdataMX, SRV: rdataSRV, NS: rdataNS,
+		TXT: rdataTXTMulti, SOA: rdataSOA, PTR: rdataPTR, MB: rdataMB, MG: rdataMG, MR: rdataMR,
+		CAA: rdataCAA, NAPTR: rdataNAPTR, TLSA: rdataTLSA, SSHFP: rdataSSHFP, DS: rdataDS,
+		RRSIG: rdataRRSIG, DNSKEY: rdataDNSKEY, URI: rdataURI, DNAME: rdataDNAME, SPF: rdataSPF,
+		SVCB: rdataSVCB, HTTPS: rdataHTTPS,
+	} {
+		rdata, err := base64.RawStdEncoding.DecodeString(b64)
+		if err != nil {
+			t.Fatalf("invalid %s fixture", rtype)
+		}
+
+		for n := 0; n < len(rdata); n++ {
+			p := &parser{res: rdata[:n]}
+			p.parse(rtype, IN, rdata[:n])
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package doh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file implements the presentation format of records, i.e. the format
+// their RDATA is written in in zone files, as described in section 5.1 of RFC
+// 1035 and in the RFCs defining each type. Domain names are written without
+// their trailing dot, like everywhere else in this package, except for the root
+// which is written as ".".
+
+// presentationName returns the given domain name in presentation format.
+func presentationName(name string) string {
+	if name == "" {
+		return "."
+	}
+
+	return name
+}
+
+// quoteString returns the given character-string in presentation format, i.e.
+// surrounded by quotes, with quotes and backslashes escaped with a backslash,
+// and non-printable characters escaped as \DDD.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// String returns the record in presentation format, i.e. its address.
+func (r *ARecord) String() string {
+	if r.IP != nil {
+		return r.IP.String()
+	}
+
+	return r.IP4
+}
+
+// String returns the record in presentation format, i.e. its address.
+func (r *AAAARecord) String() string {
+	if r.IP != nil {
+		return r.IP.String()
+	}
+
+	return r.IP6
+}
+
+// String returns the record in presentation format, i.e. its canonical name.
+func (r *CNAMERecord) String() string {
+	return presentationName(r.CNAME)
+}
+
+// String returns the record in presentation format, i.e. its quoted
+// character-strings separated by spaces.
+func (r *TXTRecord) String() string {
+	if r.Strings == nil {
+		return quoteString(r.TXT)
+	}
+
+	return presentationStrings(r.Strings)
+}
+
+// String returns the record in presentation format, i.e. its quoted
+// character-strings separated by spaces.
+func (r *SPFRecord) String() string {
+	if r.Strings == nil {
+		return quoteString(r.SPF)
+	}
+
+	return presentationStrings(r.Strings)
+}
+
+// presentationStrings returns the given character-strings quoted and separated
+// by spaces.
+func presentationStrings(strs []string) string {
+	quoted := make([]string, 0, len(strs))
+	for _, s := range strs {
+		quoted = append(quoted, quoteString(s))
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// String returns the record in presentation format, e.g.
+// "dns200.anycast.me tech.ovh.net 2019020704 86400 3600 3600000 300".
+func (r *SOARecord) String() string {
+	return fmt.Sprintf(
+		"%s %s %d %d %d %d %d",
+		presentationName(r.PrimaryNS), presentationName(r.RespMailbox),
+		r.Serial, r.Refresh, r.Retry, r.Expire, r.Minimum,
+	)
+}
+
+// String returns the record in presentation format, i.e. its domain name.
+func (r *PTRRecord) String() string {
+	return presentationName(r.PTR)
+}
+
+// String returns the record in presentation format, i.e. its domain name.
+func (r *MBRecord) String() string {
+	return presentationName(r.Name)
+}
+
+// String returns the record in presentation format, i.e. its domain name.
+func (r *MGRecord) String() string {
+	return presentationName(r.Name)
+}
+
+// String returns the record in presentation format, i.e. its domain name.
+func (r *MRRecord) String() string {
+	return presentationName(r.Name)
+}
+
+// String returns the record in presentation format, e.g. "1 mx3.ovh.net".
+func (r *MXRecord) String() string {
+	return fmt.Sprintf("%d %s", r.Pref, presentationName(r.Host))
+}
+
+// String returns the record in presentation format, e.g.
+// "10 0 8448 chat.abolivier.bzh".
+func (r *SRVRecord) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, presentationName(r.Target))
+}
+
+// String returns the record in presentation format, i.e. its host.
+func (r *NSRecord) String() string {
+	return presentationName(r.Host)
+}
+
+// String returns the record in presentation format, e.g.
+// `100 10 "S" "SIP+D2U" "" _sip._udp.example.com`.
+func (r *NAPTRRecord) String() string {
+	return fmt.Sprintf(
+		"%d %d %s %s %s %s",
+		r.Order, r.Preference,
+		quoteString(r.Flags), quoteString(r.Service), quoteString(r.Regexp),
+		presentationName(r.Replacement),
+	)
+}
+
+// String returns the record in presentation format, with the certificate
+// association data in hexadecimal, e.g. "3 1 1 a725d9...".
+func (r *TLSARecord) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Usage, r.Selector, r.MatchingType, hex.EncodeToString(r.Certificate))
+}
+
+// String returns the record in presentation format, with the fingerprint in
+// hexadecimal, e.g. "4 2 005bb6...".
+func (r *SSHFPRecord) String() string {
+	return fmt.Sprintf("%d %d %s", r.Algorithm, r.Type, r.FingerprintHex())
+}
+
+// String returns the record in presentation format, with the digest in
+// hexadecimal, e.g. "2371 13 2 067a3f...".
+func (r *DSRecord) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.KeyTag, r.Algorithm, r.DigestType, hex.EncodeToString(r.Digest))
+}
+
+// String returns the record in presentation format, with the signature's
+// validity period as YYYYMMDDHHmmSS timestamps and the signature in base64,
+// e.g. "A 13 3 300 20261015000000 20261013000000 34505 cloudflare.com ...".
+func (r *RRSIGRecord) String() string {
+	return fmt.Sprintf(
+		"%s %d %d %d %s %s %d %s %s",
+		r.TypeCovered, r.Algorithm, r.Labels, r.OriginalTTL,
+		rrsigTime(r.Expiration), rrsigTime(r.Inception), r.KeyTag,
+		presentationName(r.SignerName), base64.StdEncoding.EncodeToString(r.Signature),
+	)
+}
+
+// rrsigTime returns the given RRSIG timestamp in the YYYYMMDDHHmmSS format
+// described in section 3.2 of RFC 4034.
+func rrsigTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+// String returns the record in presentation format, with the public key in
+// base64, e.g. "257 3 13 2bjFtv...".
+func (r *DNSKEYRecord) String() string {
+	return fmt.Sprintf("%d %d %d %s", r.Flags, r.Protocol, r.Algorithm, base64.StdEncoding.EncodeToString(r.PublicKey))
+}
+
+// String returns the record in presentation format, e.g.
+// `10 1 "https://brendan.abolivier.bzh/"`.
+func (r *URIRecord) String() string {
+	return fmt.Sprintf("%d %d %s", r.Priority, r.Weight, quoteString(r.Target))
+}
+
+// String returns the record in presentation format, i.e. its target.
+func (r *DNAMERecord) String() string {
+	return presentationName(r.Target)
+}
+
+// String returns the record in presentation format, e.g.
+// `0 issue "letsencrypt.org"`.
+func (r *CAARecord) String() string {
+	return fmt.Sprintf("%d %s %s", r.Flag, r.Tag, quoteString(r.Value))
+}
+
+// svcbKeyNames maps the SvcParam keys listed in section 14.3.2 of RFC 9460 to
+// their name.
+var svcbKeyNames = map[uint16]string{
+	SVCBKeyMandatory:     "mandatory",
+	SVCBKeyALPN:          "alpn",
+	SVCBKeyNoDefaultALPN: "no-default-alpn",
+	SVCBKeyPort:          "port",
+	SVCBKeyIPv4Hint:      "ipv4hint",
+	SVCBKeyECH:           "ech",
+	SVCBKeyIPv6Hint:      "ipv6hint",
+}
+
+// svcbKeyName returns the name of the given SvcParam key, or "key" followed by
+// its value if it isn't known, as described in section 2.1 of RFC 9460.
+func svcbKeyName(key uint16) string {
+	if name, ok := svcbKeyNames[key]; ok {
+		return name
+	}
+
+	return "key" + strconv.Itoa(int(key))
+}
+
+// String returns the record in presentation format, with its SvcParams sorted
+// by key, e.g. "16 svc.example.net alpn=h2 port=8443".
+func (s *SVCBRecord) String() string {
+	keys := make([]int, 0, len(s.Params))
+	for k := range s.Params {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+
+	fields := []string{strconv.Itoa(int(s.Priority)), presentationName(s.Target)}
+	for _, k := range keys {
+		fields = append(fields, s.presentationParam(uint16(k)))
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// presentationParam returns the record's SvcParam with the given key in
+// presentation format, as described in section 7 of RFC 9460, or in the
+// generic key=value format if its value is malformed or of an unknown format.
+func (s *SVCBRecord) presentationParam(key uint16) string {
+	value := s.Params[key]
+	name := svcbKeyName(key)
+
+	switch key {
+	case SVCBKeyMandatory:
+		if len(value) > 0 && len(value)%2 == 0 {
+			names := make([]string, 0, len(value)/2)
+			for i := 0; i < len(value); i += 2 {
+				names = append(names, svcbKeyName(binary.BigEndian.Uint16(value[i:i+2])))
+			}
+			return name + "=" + strings.Join(names, ",")
+		}
+	case SVCBKeyALPN:
+		if protocols, ok := s.ALPN(); ok {
+			return name + "=" + strings.Join(protocols, ",")
+		}
+	case SVCBKeyNoDefaultALPN:
+		if len(value) == 0 {
+			return name
+		}
+	case SVCBKeyPort:
+		if port, ok := s.Port(); ok {
+			return name + "=" + strconv.Itoa(int(port))
+		}
+	case SVCBKeyIPv4Hint, SVCBKeyIPv6Hint:
+		size := net.IPv4len
+		if key == SVCBKeyIPv6Hint {
+			size = net.IPv6len
+		}
+		if len(value) > 0 && len(value)%size == 0 {
+			ips := make([]string, 0, len(value)/size)
+			for i := 0; i < len(value); i += size {
+				ips = append(ips, net.IP(value[i:i+size]).String())
+			}
+			return name + "=" + strings.Join(ips, ",")
+		}
+	case SVCBKeyECH:
+		return name + "=" + base64.StdEncoding.EncodeToString(value)
+	}
+
+	return name + "=" + quoteString(string(value))
+}
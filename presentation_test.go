@@ -0,0 +1,77 @@
+package doh
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+)
+
+func TestRecordString(t *testing.T) {
+	tests := []struct {
+		t        DNSType
+		rdata    string
+		expected string
+	}{
+		{A, rdataA, expectedA},
+		{AAAA, rdataAAAA, "2001:41d0:302:1100::a:d8f1"},
+		{CNAME, rdataCNAME, expectedCNAME},
+		{MX, rdataMX, "1 mx3.ovh.net"},
+		{SRV, rdataSRV, "10 0 8448 chat.abolivier.bzh"},
+		{NS, rdataNS, expectedNSHost},
+		{TXT, rdataTXT, `"4|https://brendan.abolivier.bzh"`},
+		{TXT, rdataTXTMulti, `"v=spf1 include:mx.ovh.com" " ~all"`},
+		{SPF, rdataSPF, `"v=spf1 include:mx.ovh.com" " ~all"`},
+		{SOA, rdataSOA, "dns200.anycast.me tech.ovh.net 2019020704 86400 3600 3600000 300"},
+		{PTR, rdataPTR, expectedPTR},
+		{MB, rdataMB, expectedMB},
+		{MG, rdataMG, expectedMG},
+		{MR, rdataMR, expectedMR},
+		{CAA, rdataCAA, `0 issue "letsencrypt.org"`},
+		{NAPTR, rdataNAPTR, `100 10 "S" "SIP+D2U" "" _sip._udp.example.com`},
+		{TLSA, rdataTLSA, "3 1 1 " + expectedTLSACertificate},
+		{SSHFP, rdataSSHFP, "4 2 " + expectedSSHFPFingerprint},
+		{DS, rdataDS, "2371 13 2 " + expectedDSDigest},
+		{
+			RRSIG, rdataRRSIG,
+			"A 13 2 300 20261015000000 20261013000000 34505 cloudflare.com " + expectedRRSIGSignature,
+		},
+		{DNSKEY, rdataDNSKEY, "257 3 13 " + expectedDNSKEYPublicKey},
+		{URI, rdataURI, `10 1 "https://brendan.abolivier.bzh/"`},
+		{DNAME, rdataDNAME, expectedDNAMETarget},
+		{SVCB, rdataSVCB, "16 svc.example.net alpn=h2 port=8443"},
+		{
+			HTTPS, rdataHTTPS,
+			"1 . alpn=h3,h2 ipv4hint=104.16.132.229,104.16.133.229 " +
+				"ipv6hint=2606:4700::6810:84e5,2606:4700::6810:85e5",
+		},
+	}
+
+	p := new(parser)
+	for _, test := range tests {
+		rdata, err := base64.RawStdEncoding.DecodeString(test.rdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec, err := p.parse(test.t, IN, rdata)
+		if err != nil {
+			t.Fatalf("%s: %v", test.t, err)
+		}
+
+		s, ok := rec.(fmt.Stringer)
+		if !ok {
+			t.Errorf("%s: record doesn't implement fmt.Stringer", test.t)
+			continue
+		}
+
+		if s.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.t, test.expected, s.String())
+		}
+	}
+}
+
+func TestQuoteString(t *testing.T) {
+	if s := quoteString("a \"quoted\" \\ string\n"); s != `"a \"quoted\" \\ string\010"` {
+		t.Errorf("unexpected string %s", s)
+	}
+}
@@ -2,19 +2,68 @@ package doh
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/binary"
-	"math/rand"
 	"strings"
-	"time"
 )
 
-// encodeQuery creates a DNS query message from the given fqdn, type and class.
-func encodeQuery(fqdn string, t DNSType, c DNSClass) []byte {
+// queryOptions holds the settings used to encode a query. Its zero value
+// describes a standard recursive query.
+type queryOptions struct {
+	// validate, when true, asks the server to perform DNSSEC validation and to
+	// report its result in the response's AD bit, by setting CD = 0 and AD = 1
+	// as described in section 5.7 of RFC 6840.
+	validate bool
+	// zeroID, when true, sets the query's ID to 0 instead of a random value,
+	// as recommended by section 4.1 of RFC 8484 in order to make responses to
+	// identical queries cacheable by HTTP caches.
+	zeroID bool
+	// ednsOptions holds the EDNS options to include in the query. If it isn't
+	// empty, an OPT record holding them is added to the query's additional
+	// section.
+	ednsOptions []ednsOption
+	// pad, when true, adds an EDNS Padding option to the query so that its
+	// length is a multiple of paddingBlockSize, as recommended by RFC 8467.
+	pad bool
+	// payloadSize, if non-zero, is the UDP payload size to advertise in the
+	// query's OPT record, which is then always added to the query. Defaults to
+	// defaultEDNSPayloadSize if the OPT record is added for another reason.
+	payloadSize uint16
+	// dnssecOK, when true, sets the DO bit in the query's OPT record, which is
+	// then always added to the query, so that the server includes DNSSEC
+	// records (e.g. RRSIG) in its response, as described in RFC 3225.
+	dnssecOK bool
+	// randomizeCase, when true, randomizes the case of the letters of the
+	// query's name, as described in the "Use of Bit 0x20 in DNS Labels to
+	// Improve Transaction Identity" draft.
+	randomizeCase bool
+	// moreTypes holds the types to ask about the same name and class in
+	// additional questions, after the question for the query's type.
+	moreTypes []DNSType
+	// noCache, when true, makes the lookup send its query even if the
+	// resolver's cache holds a response to it, which is then replaced with
+	// the new response.
+	noCache bool
+}
+
+// encodeQuery creates a DNS query message from the given fqdn, type and class,
+// using the given options.
+// Returns ErrInvalidName if the FQDN isn't a valid domain name.
+func encodeQuery(fqdn string, t DNSType, c DNSClass, opts queryOptions) ([]byte, error) {
+	if err := checkName(fqdn); err != nil {
+		return nil, err
+	}
+
 	q := bytes.NewBuffer(nil)
 
 	reqID := []byte{0, 0}
-	r := rand.New(rand.NewSource(time.Now().Unix()))
-	binary.BigEndian.PutUint16(reqID, uint16(r.Int31()))
+	if !opts.zeroID {
+		// If no randomness is available, fall back to an ID of 0, which is
+		// valid for DoH.
+		if _, err := rand.Read(reqID); err != nil {
+			reqID[0], reqID[1] = 0, 0
+		}
+	}
 
 	/*
 		DNS HEADER
@@ -35,6 +84,21 @@ func encodeQuery(fqdn string, t DNSType, c DNSClass) []byte {
 		|                    ARCOUNT                    |
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
+	// AD = 0, CD = 1
+	adcd := byte(1 << 4)
+	arcount := byte(0)
+	useOPT := len(opts.ednsOptions) > 0 || opts.pad || opts.payloadSize > 0 || opts.dnssecOK
+	if useOPT {
+		arcount = 1
+	}
+	if opts.validate {
+		// AD = 1, CD = 0
+		adcd = 1 << 5
+	}
+
+	qdcount := []byte{0, 0}
+	binary.BigEndian.PutUint16(qdcount, uint16(1+len(opts.moreTypes)))
+
 	q.Write([]byte{
 		reqID[0], reqID[1],
 		// QR = 0 (query)
@@ -45,18 +109,17 @@ func encodeQuery(fqdn string, t DNSType, c DNSClass) []byte {
 		(0 << 7) | (0 << 3) | (0 << 1) | 1,
 		// RA ignored
 		// Z = 0 (reserved)
-		// AD = 0
-		// CD = 1
+		// AD and CD set above
 		// RCODE ignored
-		(1 << 4),
-		// QDCOUNT = 1
-		byte(0), byte(1),
+		adcd,
+		// QDCOUNT = 1, plus the number of additional questions
+		qdcount[0], qdcount[1],
 		// ANCOUNT = 0
 		byte(0), byte(0),
 		// NSCOUNT = 0
 		byte(0), byte(0),
-		// ARCOUNT = 0
-		byte(0), byte(0),
+		// ARCOUNT = 1 if there's an OPT record, 0 otherwise
+		byte(0), arcount,
 	})
 
 	qtype := []byte{0, 0}
@@ -79,14 +142,123 @@ func encodeQuery(fqdn string, t DNSType, c DNSClass) []byte {
 		|                     QCLASS                    |
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
-	labels := strings.Split(fqdn, ".")
-	for _, l := range labels {
-		q.Write([]byte{byte(len(l))})
-		q.Write([]byte(l))
+	if opts.randomizeCase {
+		fqdn = randomizeCase(fqdn)
 	}
-	q.Write([]byte{0})
+	writeName(q, fqdn)
 	q.Write(qtype)
 	q.Write(qclass)
 
-	return q.Bytes()
+	// Additional questions refer to the first question's name with a
+	// compression pointer, as described in section 4.1.4 of RFC 1035.
+	for _, t := range opts.moreTypes {
+		binary.BigEndian.PutUint16(qtype, uint16(t))
+		q.Write([]byte{0xc0, DNSMsgHeaderLen})
+		q.Write(qtype)
+		q.Write(qclass)
+	}
+
+	if useOPT {
+		options := opts.ednsOptions
+		if opts.pad {
+			// The padding option must be the last one, since its length
+			// depends on the length of the rest of the message.
+			options = append(options[:len(options):len(options)], paddingOption(q.Len(), options))
+		}
+		payloadSize := opts.payloadSize
+		if payloadSize == 0 {
+			payloadSize = defaultEDNSPayloadSize
+		}
+		writeOPT(q, payloadSize, opts.dnssecOK, options)
+	}
+
+	return q.Bytes(), nil
+}
+
+// randomizeCase returns the given name with each of its ASCII letters randomly
+// turned into upper or lower case. Other bytes are left unchanged.
+// Returns the name unchanged if no randomness is available.
+func randomizeCase(name string) string {
+	bits := make([]byte, len(name))
+	if _, err := rand.Read(bits); err != nil {
+		return name
+	}
+
+	b := []byte(name)
+	for i, c := range b {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+			if bits[i]&1 == 1 {
+				b[i] = c &^ 0x20
+			} else {
+				b[i] = c | 0x20
+			}
+		}
+	}
+
+	return string(b)
+}
+
+// The query types of zone transfers, as described in RFC 1995 and RFC 5936.
+const (
+	typeIXFR DNSType = 251
+	typeAXFR DNSType = 252
+)
+
+// checkQueryType checks that the given type can be looked up over DoH, i.e.
+// that it isn't a zone transfer, which needs multiple messages (or a TCP
+// connection) to be carried.
+// Returns ErrUnsupportedQueryType if it can't.
+func checkQueryType(t DNSType) error {
+	if t == typeIXFR || t == typeAXFR {
+		return ErrUnsupportedQueryType
+	}
+
+	return nil
+}
+
+// Limits on the length of names, as described in section 2.3.4 of RFC 1035.
+const (
+	maxLabelLen = 63
+	maxNameLen  = 255
+)
+
+// checkName checks that the given domain name can be written in wire format,
+// i.e. that none of its labels is empty or longer than 63 octets, and that it
+// isn't longer than 255 octets once encoded. The name can end with a dot, and
+// can be empty or "." to designate the root.
+// Returns ErrInvalidName if the name is invalid.
+func checkName(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return nil
+	}
+
+	// Account for the root label.
+	length := 1
+	for _, l := range strings.Split(name, ".") {
+		if len(l) == 0 || len(l) > maxLabelLen {
+			return ErrInvalidName
+		}
+		length += len(l) + 1
+	}
+
+	if length > maxNameLen {
+		return ErrInvalidName
+	}
+
+	return nil
+}
+
+// writeName writes the given domain name to the given buffer, as a sequence of
+// labels terminated by the root label, as described in section 3.1 of RFC 1035.
+// The name is expected to have been checked with checkName.
+func writeName(b *bytes.Buffer, name string) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, l := range strings.Split(name, ".") {
+			b.Write([]byte{byte(len(l))})
+			b.Write([]byte(l))
+		}
+	}
+	b.Write([]byte{0})
 }
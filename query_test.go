@@ -1,15 +1,26 @@
 package doh
 
 import (
+	"bytes"
 	"encoding/base64"
+	"strings"
 	"testing"
 )
 
 // Test data
 const queryEncodedB64 = "ARAAAQAAAAAAAAdicmVuZGFuCWFib2xpdmllcgNiemgAAAEAAQ"
 
+// mustEncodeQuery encodes a query for a name known to be valid.
+func mustEncodeQuery(fqdn string, t DNSType, c DNSClass, opts queryOptions) []byte {
+	q, err := encodeQuery(fqdn, t, c, opts)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
 func TestEncodeQuery(t *testing.T) {
-	q := encodeQuery("brendan.abolivier.bzh", A, IN)
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
 
 	// Don't check the randomly generated ID.
 	q = q[2:]
@@ -17,3 +28,194 @@ func TestEncodeQuery(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestEncodeQueryTrailingDot(t *testing.T) {
+	q := mustEncodeQuery("example.com", A, IN, queryOptions{zeroID: true})
+	fq := mustEncodeQuery("example.com.", A, IN, queryOptions{zeroID: true})
+	if !bytes.Equal(q, fq) {
+		t.Fail()
+	}
+
+	q = mustEncodeQuery("brendan.abolivier.bzh.", A, IN, queryOptions{})
+	if base64.RawStdEncoding.EncodeToString(q[2:]) != queryEncodedB64 {
+		t.Fail()
+	}
+}
+
+func TestEncodeQueryRoot(t *testing.T) {
+	for _, name := range []string{"", "."} {
+		q := mustEncodeQuery(name, NS, IN, queryOptions{})
+		// The root name is a single zero byte.
+		if !bytes.Equal(q[DNSMsgHeaderLen:], []byte{0, 0, 2, 0, 1}) {
+			t.Errorf("unexpected question %v for %q", q[DNSMsgHeaderLen:], name)
+		}
+	}
+
+	if _, err := encodeQuery("..", NS, IN, queryOptions{}); err != ErrInvalidName {
+		t.Fail()
+	}
+}
+
+func TestLookupRoot(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		rdata := bytes.NewBuffer(nil)
+		writeName(rdata, "a.root-servers.net")
+		// Owner = root
+		rr := append([]byte{0}, buildRR(NS, 518400, rdata.Bytes())[2:]...)
+		return buildResponse(q, rr)
+	})
+
+	recs, _, err := r.LookupNS(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].Host != "a.root-servers.net" || recs[0].Owner != "" {
+		t.Fail()
+	}
+}
+
+func TestEncodeQueryInvalidName(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	names := []string{
+		// Label longer than 63 octets.
+		label + "a.abolivier.bzh",
+		// Name longer than 255 octets.
+		strings.Repeat(label+".", 4) + "bzh",
+		// Empty label.
+		"brendan..bzh",
+		"a..b",
+		".abolivier.bzh",
+	}
+
+	for _, name := range names {
+		if _, err := encodeQuery(name, A, IN, queryOptions{}); err != ErrInvalidName {
+			t.Errorf("%s: expected ErrInvalidName, got %v", name, err)
+		}
+	}
+
+	// The longest possible name, i.e. 255 octets once encoded.
+	name := strings.Repeat(label+".", 3) + strings.Repeat("a", 61)
+	if _, err := encodeQuery(name, A, IN, queryOptions{}); err != nil {
+		t.Fail()
+	}
+}
+
+func TestLookupInvalidName(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		t.Fatal("query sent for an invalid name")
+		return nil
+	})
+
+	_, _, err := r.LookupA(strings.Repeat("a", 64) + ".bzh")
+	if err != ErrInvalidName {
+		t.Fail()
+	}
+}
+
+func TestEncodeQueryValidate(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{validate: true})
+
+	// Check AD = 1 and CD = 0.
+	if q[3]>>5&1 != 1 || q[3]>>4&1 != 0 {
+		t.Fail()
+	}
+}
+
+func TestEncodeQueryZeroID(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{zeroID: true})
+	if q[0] != 0 || q[1] != 0 {
+		t.Fail()
+	}
+
+	if base64.RawStdEncoding.EncodeToString(q[2:]) != queryEncodedB64 {
+		t.Fail()
+	}
+}
+
+func TestLookupZeroID(t *testing.T) {
+	var id []byte
+	r := newStubResolver(func(q []byte) []byte {
+		id = q[0:2]
+		return buildResponse(q)
+	})
+	r.ZeroID = true
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+		t.Fatal(err)
+	}
+
+	if id[0] != 0 || id[1] != 0 {
+		t.Fail()
+	}
+}
+
+func TestEncodeQueryRandomizeCase(t *testing.T) {
+	const name = "brendan-2.abolivier.bzh"
+	opts := queryOptions{zeroID: true, randomizeCase: true}
+	first := mustEncodeQuery(name, A, IN, opts)
+
+	// With 19 letters, all of the queries having the same case is very
+	// unlikely.
+	differ := false
+	for i := 0; i < 5 && !differ; i++ {
+		differ = !bytes.Equal(mustEncodeQuery(name, A, IN, opts), first)
+	}
+	if !differ {
+		t.Error("the case of the name isn't randomized")
+	}
+
+	p := &parser{res: first}
+	qname, _, err := p.parseName(first[DNSMsgHeaderLen:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the case of the letters changes.
+	if !strings.EqualFold(qname, name) || !strings.Contains(qname, "-2.") {
+		t.Errorf("unexpected name %s", qname)
+	}
+}
+
+func TestLookupRandomize0x20(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+	r.Randomize0x20 = true
+
+	// The response echoes the question.
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || !strings.EqualFold(recs[0].Owner, "brendan.abolivier.bzh") {
+		t.Fail()
+	}
+
+	// The response's question is for the same name, but with the case of
+	// each letter swapped.
+	r = newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		for i := DNSMsgHeaderLen; res[i] != 0; i++ {
+			if c := res[i] | 0x20; 'a' <= c && c <= 'z' {
+				res[i] ^= 0x20
+			}
+		}
+		return res
+	})
+	r.Randomize0x20 = true
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrCaseMismatch {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestEncodeQueryClass(t *testing.T) {
+	q := mustEncodeQuery("version.bind", TXT, CH, queryOptions{})
+
+	// QTYPE = TXT, QCLASS = CH
+	if !bytes.Equal(q[len(q)-4:], []byte{0, 16, 0, 3}) {
+		t.Fail()
+	}
+}
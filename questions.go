@@ -0,0 +1,74 @@
+package doh
+
+import (
+	"context"
+	"errors"
+)
+
+// LookupMulti performs a DoH lookup on records of each of the given types for
+// the given FQDN, bounded by the given context, sending a single query with
+// one question per type, e.g. to fetch the A and MX records of a name in one
+// round trip.
+// Many servers don't support queries with several questions, which is why,
+// if the server rejects the query (with a FORMERR or NOTIMP response code) or
+// doesn't answer every question, one lookup per type is performed instead.
+// Returns the records grouped by type, in the order they appear in within each
+// group. Each record is one of the *XRecord types of this package, depending
+// on its type, or nil if this package doesn't support parsing records of that
+// type. Types without any record aren't included.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers, or ErrUnsupportedQueryType if one of the types
+// is AXFR or IXFR, without sending any query.
+func (r *Resolver) LookupMulti(ctx context.Context, fqdn string, types []DNSType) (map[DNSType][]Record, error) {
+	recs := make(map[DNSType][]Record)
+	if len(types) == 0 {
+		return recs, nil
+	}
+
+	msg, err := r.lookupOpts(ctx, fqdn, types[0], r.class(), queryOptions{moreTypes: types[1:]})
+	if len(types) > 1 && isMultiQuestionRejection(err) {
+		return r.lookupEach(ctx, fqdn, types)
+	}
+	if err != nil && msg == nil {
+		return nil, err
+	}
+
+	for _, a := range msg.answers {
+		for _, t := range types {
+			if a.t == t {
+				recs[t] = append(recs[t], a.parsed)
+				break
+			}
+		}
+	}
+
+	return recs, err
+}
+
+// lookupEach performs a DoH lookup on records of each of the given types for
+// the given FQDN, one after the other, and returns the records grouped by
+// type, as LookupMulti does.
+// Returns the error of the first lookup which failed, if any.
+func (r *Resolver) lookupEach(ctx context.Context, fqdn string, types []DNSType) (map[DNSType][]Record, error) {
+	recs := make(map[DNSType][]Record)
+	for _, t := range types {
+		typeRecs, _, err := r.Lookup(ctx, fqdn, t)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(typeRecs) > 0 {
+			recs[t] = typeRecs
+		}
+	}
+
+	return recs, nil
+}
+
+// isMultiQuestionRejection returns whether the given error means that the
+// server doesn't support queries with several questions, i.e. that it responded
+// with a FORMERR or NOTIMP response code, or that it didn't answer every
+// question.
+func isMultiQuestionRejection(err error) bool {
+	return errors.Is(err, ErrFormatError) || errors.Is(err, ErrNotImplemented) || err == ErrQuestionMismatch
+}
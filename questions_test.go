@@ -0,0 +1,104 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+func TestEncodeQueryMoreTypes(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{moreTypes: []DNSType{MX}})
+	single := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+
+	// The second question points at the first one's name.
+	expected := []byte{0xc0, DNSMsgHeaderLen, 0, 15, 0, 1}
+	if binary.BigEndian.Uint16(q[4:6]) != 2 || !bytes.Equal(q[len(single):], expected) {
+		t.Errorf("unexpected query %v", q)
+	}
+}
+
+// mxRDATA is the RDATA of the MX record of brendan.abolivier.bzh.
+var mxRDATA = func() []byte {
+	rdata := bytes.NewBufferString("\x00\x0a")
+	writeName(rdata, "mx.abolivier.bzh")
+	return rdata.Bytes()
+}()
+
+func TestLookupMulti(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}), buildRR(MX, 300, mxRDATA))
+	})
+
+	recs, err := r.LookupMulti(context.Background(), "brendan.abolivier.bzh", []DNSType{A, MX})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkMultiRecords(t, recs)
+}
+
+func TestLookupMultiFallback(t *testing.T) {
+	var queries int
+	r := newStubResolver(func(q []byte) []byte {
+		queries++
+		res := buildResponse(q)
+		if binary.BigEndian.Uint16(q[4:6]) > 1 {
+			// FORMERR
+			res[3] |= 1
+			return res
+		}
+
+		switch DNSType(binary.BigEndian.Uint16(q[len(q)-4:])) {
+		case A:
+			return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		case MX:
+			return buildResponse(q, buildRR(MX, 300, mxRDATA))
+		}
+		return res
+	})
+
+	recs, err := r.LookupMulti(context.Background(), "brendan.abolivier.bzh", []DNSType{A, MX})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkMultiRecords(t, recs)
+	if queries != 3 {
+		t.Errorf("expected 3 queries, got %d", queries)
+	}
+}
+
+// checkMultiRecords checks that the given records are the A and MX records of
+// brendan.abolivier.bzh.
+func checkMultiRecords(t *testing.T, recs map[DNSType][]Record) {
+	if len(recs) != 2 || len(recs[A]) != 1 || len(recs[MX]) != 1 {
+		t.Fatalf("unexpected records %v", recs)
+	}
+
+	if recs[A][0].(*ARecord).IP4 != expectedA {
+		t.Fail()
+	}
+
+	if mx := recs[MX][0].(*MXRecord); mx.Pref != 10 || mx.Host != "mx.abolivier.bzh" {
+		t.Errorf("unexpected MX record %+v", mx)
+	}
+}
+
+func TestLookupMultiZoneTransfer(t *testing.T) {
+	var queries int
+	r := newStubResolver(func(q []byte) []byte {
+		queries++
+		return buildResponse(q)
+	})
+
+	for _, zt := range []DNSType{typeAXFR, typeIXFR} {
+		if _, err := r.LookupMulti(context.Background(), "abolivier.bzh", []DNSType{SOA, zt}); err != ErrUnsupportedQueryType {
+			t.Errorf("unexpected error %v for %d", err, zt)
+		}
+	}
+
+	if queries != 0 {
+		t.Errorf("expected no query, got %d", queries)
+	}
+}
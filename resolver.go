@@ -1,253 +1,1264 @@
 // Package doh implements client operations for DoH (DNS over HTTPS) lookups.
 package doh
 
-import "net/http"
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Resolver handles lookups.
+// A Resolver must not be copied after its first use.
 type Resolver struct {
 	// The host to send DoH requests to.
 	Host string
+	// BootstrapAddr, if set, is the IP address (optionally with a port) to
+	// connect to in order to reach Host, so that Host doesn't need to be
+	// resolved with the system's resolver. Host is still used for the TLS
+	// server name and the Host header. This requires the transport of
+	// HTTPClient to be nil or a *http.Transport. If the transport sends
+	// requests through a proxy, the proxy resolves Host instead.
+	BootstrapAddr string
 	// The DNS class to lookup with, must be one of IN, CS, CH, HS or ANYCLASS.
-	// As a hint, the most used class nowadays is IN (Internet).
+	// As a hint, the most used class nowadays is IN (Internet), which is also
+	// the class used if Class is zero. Other classes are e.g. useful to send
+	// diagnostic queries such as CH TXT version.bind. A and AAAA lookups are
+	// always performed with the IN class, and fail with ErrNotIN if Class is
+	// neither IN nor ANYCLASS.
 	Class DNSClass
-	// HttpClient is a http.Client used to connect to DoH server
+	// HttpClient is a http.Client used to connect to DoH server. If nil, a
+	// client with a timeout of DefaultHTTPTimeout is used, so that a server
+	// which never responds can't block lookups forever.
 	HTTPClient *http.Client
+	// Exchanger, if set, is used to send queries instead of sending them to
+	// Host over HTTPS, in which case Host and the HTTP-related options (i.e.
+	// BootstrapAddr, HTTPClient, Headers, Path, Method, Auth and OnConn) are
+	// ignored. It isn't used with FormatJSON.
+	Exchanger Exchanger
+	// Headers holds HTTP headers to add to every DoH request. They override
+	// the headers the resolver sets by default (including Accept,
+	// Content-Type and User-Agent), except the Authorization header if Auth is
+	// set.
+	Headers http.Header
+	// Accept is the media type of the DoH responses the resolver accepts,
+	// which is sent in the Accept header of its requests, e.g. for DoH
+	// deployments using a non-standard one. Defaults to
+	// "application/dns-message", or to "application/dns-json" with
+	// FormatJSON, if empty. Responses of another media type are rejected.
+	Accept string
+	// ContentType is the media type of the bodies of the POST requests the
+	// resolver sends, which is sent in their Content-Type header. Defaults to
+	// "application/dns-message" if empty.
+	ContentType string
+	// Path is the path of the URL to send DoH requests to, which can include a
+	// query string. Defaults to "/dns-query" if empty.
+	Path string
+	// Format is the format DoH requests and responses are sent in. Defaults to
+	// FormatWire. With FormatJSON, requests are always sent with GET, and
+	// lookups in a class other than IN fail with ErrJSONClass. The options
+	// relying on the wire format are ignored: Method, ClientSubnet, Pad,
+	// ZeroID, Randomize0x20 and TSIG. JSON requests don't carry the DO, AD or
+	// CD bits either, so DNSSECOK, RequireAuthenticatedData and
+	// LookupAValidated don't change the query, although the AD bit of the
+	// response is still reported and checked.
+	Format Format
+	// Method is the HTTP method to send DoH requests with, must be either
+	// http.MethodPost or http.MethodGet. Defaults to http.MethodPost if empty.
+	// Unlike POST requests, GET requests can be cached by HTTP caches.
+	Method string
+	// QueryTimeout, if non-zero, bounds the time each individual DoH query can
+	// take, regardless of the deadline of the context the lookup is performed
+	// with. It's a per-attempt timeout: each retry (see MaxRetries) gets its
+	// own QueryTimeout, and a query which exceeds it is retried, while the
+	// context (or DefaultTimeout) still bounds the lookup as a whole, e.g. a
+	// QueryTimeout of 2s with a context with a 5s timeout gives up after 5s.
+	QueryTimeout time.Duration
+	// DefaultTimeout, if non-zero, bounds the time lookups performed with the
+	// methods which don't take a context (e.g. LookupA) can take as a whole,
+	// including retries. Lookups performed with a context are only bounded
+	// by it.
+	DefaultTimeout time.Duration
+	// RejectPrivateAddrs, when true, makes lookups fail with ErrPrivateAddr
+	// if an A or AAAA answer contains a private, loopback, link-local or
+	// otherwise reserved address, which is useful to protect against DNS
+	// rebinding attacks. This applies to every lookup, e.g. to Lookup and
+	// LookupMulti as well as LookupA and LookupAAAA.
+	RejectPrivateAddrs bool
+	// BestEffort, when true, makes lookups parse every answer of a response
+	// independently instead of failing at the first one that can't be parsed.
+	// In this case, lookups return the records that could be parsed, along
+	// with an AnswerErrors describing the answers that couldn't. Records from
+	// the authority and additional sections that can't be parsed are dropped
+	// without any error, since they don't affect the lookup's result.
+	BestEffort bool
+	// ReportNoData, when true, makes lookups return a *NoDataError when the
+	// server responds successfully but without any answer of the type that
+	// was looked up (e.g. only with the CNAME records leading to the name),
+	// instead of returning no record and no error.
+	ReportNoData bool
+	// ClientSubnet, if set, is sent to the server as an EDNS Client Subnet
+	// option, as described in RFC 7871, so that it can tailor its answers to
+	// the client's network (e.g. for CDNs). Only the bits of the address within
+	// the subnet's prefix are sent.
+	ClientSubnet *net.IPNet
+	// Pad, when true, makes the resolver pad its queries to a multiple of 128
+	// bytes using the EDNS Padding option, as recommended by RFC 8467, so that
+	// their length reveals less about the names being looked up. Note that the
+	// padding doesn't account for the TSIG record, if any.
+	Pad bool
+	// ZeroID, when true, makes the resolver send its queries with an ID of 0
+	// instead of a random one, as recommended by section 4.1 of RFC 8484, so
+	// that responses to identical queries can be cached by HTTP caches (which
+	// is mostly useful along with the GET method).
+	ZeroID bool
+	// Randomize0x20, when true, makes the resolver randomize the case of the
+	// letters of the names it looks up, and reject responses which question
+	// doesn't echo the name with the same case with ErrCaseMismatch, as
+	// described in the "Use of Bit 0x20 in DNS Labels to Improve Transaction
+	// Identity" draft. This makes forged responses harder to get accepted.
+	// Note that the owner names of records can then have the randomized case.
+	Randomize0x20 bool
+	// NormalizeNames, when true, makes lookups return the names from records
+	// (i.e. their owner names, and the names they hold such as the target of
+	// CNAME records) lowercased and with a trailing dot, e.g.
+	// "blog.brendan.abolivier.bzh.", so that they can be compared and used as
+	// map keys consistently. Otherwise, names are returned with the case the
+	// server sent them with, and without any trailing dot.
+	NormalizeNames bool
+	// RotateAnswers, when true, makes every lookup on A or AAAA records rotate
+	// the records it returns (along with their TTLs) by one more position
+	// than the previous one, so that callers using the first address spread
+	// their load across all of them. Otherwise, records are returned in the
+	// order the server sent them in.
+	RotateAnswers bool
+	// DNSSECOK, when true, makes the resolver set the DO bit in its queries, as
+	// described in RFC 3225, so that the server includes DNSSEC records (e.g.
+	// RRSIG) in its responses. This is mostly useful to tools looking up DS or
+	// DNSKEY records.
+	DNSSECOK bool
+	// RequireAuthenticatedData, when true, makes the resolver set the DO bit
+	// in its queries (as DNSSECOK does) and ask the server to validate the
+	// answers (with AD = 1 and CD = 0), and makes lookups fail with
+	// ErrNotAuthenticated if the server doesn't set the AD bit in a successful
+	// response, i.e. if it doesn't report the answers as validated using
+	// DNSSEC. The answers aren't validated locally, so this is only meaningful
+	// if the connection to the server is trusted.
+	RequireAuthenticatedData bool
+	// Cache, if set, is used to cache successful responses until their TTL
+	// expires, and to answer lookups from it when possible.
+	Cache *Cache
+	// TSIG, if set, makes the resolver sign its queries and verify the
+	// signature of the responses using TSIG, as described in RFC 8945.
+	TSIG *TSIGConfig
+	// Auth, if set, holds the credentials to authenticate every DoH request
+	// with, for endpoints which require authentication.
+	Auth *Auth
+	// BatchParallelism, if positive, is the maximum number of lookups
+	// LookupBatch performs concurrently. Defaults to DefaultBatchParallelism.
+	BatchParallelism int
+	// MaxRetries is the number of times a query is sent again after failing
+	// with a transient error, i.e. a network error or a 429, 502, 503 or 504
+	// HTTP status code, as well as a SERVFAIL response code if
+	// RetryServerFailure is true. Queries aren't retried if it's zero. If the
+	// server responds with a Retry-After header, it takes precedence over
+	// RetryBackoff.
+	MaxRetries int
+	// RetryBackoff, if set, returns the time to wait for before the given
+	// retry (starting at 1). Defaults to DefaultRetryBackoff.
+	RetryBackoff func(retry int) time.Duration
+	// RetryServerFailure, when true, makes the resolver also retry queries
+	// the server responded to with a SERVFAIL response code.
+	RetryServerFailure bool
+	// OnQuery, if set, is called before each DoH query the resolver sends
+	// (including retries), with the name and type being looked up, e.g. to
+	// collect metrics. Lookups answered from the cache don't send any query.
+	OnQuery func(fqdn string, t DNSType)
+	// OnResponse, if set, is called after each DoH query the resolver sends,
+	// with the name and type being looked up, the time the query took, and
+	// the error it failed with, if any.
+	OnResponse func(fqdn string, t DNSType, latency time.Duration, err error)
+	// OnConn, if set, is called after each DoH request the resolver sends,
+	// with information about the connection it has been sent over, e.g.
+	// whether it has been reused or the time its TLS handshake took.
+	OnConn func(info ConnInfo)
+
+	// rotations is the number of lookups which answers have been rotated,
+	// if RotateAnswers is true.
+	rotations uint32
+	// bootstrapMu guards bootstrap.
+	bootstrapMu sync.Mutex
+	// bootstrap is the transport derived from the one of HTTPClient in order
+	// to connect to BootstrapAddr, if it's set.
+	bootstrap *bootstrapTransport
+}
+
+// defaultContext returns the context lookups performed with the methods which
+// don't take a context use, i.e. a background context, with a timeout of
+// r.DefaultTimeout if it's set.
+func (r *Resolver) defaultContext() (context.Context, context.CancelFunc) {
+	if r.DefaultTimeout > 0 {
+		return context.WithTimeout(context.Background(), r.DefaultTimeout)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+// class returns the class lookups are performed with, i.e. r.Class, or IN if
+// it isn't set.
+func (r *Resolver) class() DNSClass {
+	if r.Class == 0 {
+		return IN
+	}
+
+	return r.Class
 }
 
 // lookup encodes a DNS query, sends it over HTTPS then parses the response.
+// Every query sent as part of the lookup derives from ctx, so that its
+// deadline bounds the whole operation. Queries failing with a transient error
+// are retried according to the resolver's retry policy, and if the response
+// is truncated, the query is sent again once, advertising a larger EDNS
+// payload size.
 // Returns an error if something went wrong at the network level, or when
-// parsing the response headers.
-func (r *Resolver) lookup(fqdn string, t DNSType, c DNSClass) ([]answer, error) {
-	q := encodeQuery(fqdn, t, c)
-	res, err := r.exchangeHTTPS(q)
+// parsing the response. The message is returned along with the error if the
+// response includes an error code, if the error is a *NoDataError, or in
+// best-effort mode if the error is an AnswerErrors; in any other case, no
+// message is returned if there's an error.
+func (r *Resolver) lookup(ctx context.Context, fqdn string, t DNSType, c DNSClass) (*message, error) {
+	return r.lookupOpts(ctx, fqdn, t, c, queryOptions{})
+}
+
+// lookupOpts is the same as lookup, but encodes the query using the given
+// options.
+func (r *Resolver) lookupOpts(ctx context.Context, fqdn string, t DNSType, c DNSClass, opts queryOptions) (*message, error) {
+	if r.Host == "" && r.Exchanger == nil {
+		return nil, ErrNoHost
+	}
+
+	for _, t := range append([]DNSType{t}, opts.moreTypes...) {
+		if err := checkQueryType(t); err != nil {
+			return nil, err
+		}
+	}
+
+	opts, err := r.queryOptions(opts)
 	if err != nil {
 		return nil, err
 	}
-	return parseResponse(res)
+
+	// Responses to queries with several questions aren't cached, since the
+	// cache is keyed by a single type.
+	var key cacheKey
+	cache := r.Cache != nil && len(opts.moreTypes) == 0
+	if cache {
+		key = newCacheKey(fqdn, t, c, opts)
+		key.normalizeNames = r.NormalizeNames
+		if msg, ok := r.Cache.get(key); ok && !opts.noCache {
+			return r.checkResponse(msg, t, opts)
+		}
+	}
+
+	msg, err := r.exchangeRetry(ctx, fqdn, t, c, opts)
+	if err == ErrTruncated {
+		// The whole message is sent over HTTP so truncation shouldn't happen
+		// with DoH, but a misbehaving server might still truncate its answer
+		// if it thinks we can't handle a large one. In this case, try again
+		// once, advertising the largest payload size possible.
+		opts.payloadSize = maxEDNSPayloadSize
+		msg, err = r.exchangeRetry(ctx, fqdn, t, c, opts)
+	}
+
+	if err != nil {
+		if msg != nil && r.RejectPrivateAddrs && msg.hasBogon() {
+			return nil, ErrPrivateAddr
+		}
+		return msg, err
+	}
+
+	if cache {
+		r.Cache.put(key, msg)
+	}
+
+	return r.checkResponse(msg, t, opts)
 }
 
-// LookupA performs a DoH lookup on A records for the given FQDN.
+// checkResponse checks the given successful response to a lookup on the given
+// type, performed with the given options, whether it comes from the server or
+// from the cache.
+// Returns ErrNotAuthenticated if r.RequireAuthenticatedData is true and the
+// server didn't set the AD bit in the response, ErrPrivateAddr if
+// r.RejectPrivateAddrs is true and an answer has a reserved address, or the
+// response along with a *NoDataError if r.ReportNoData is true and it has no
+// answer of the looked up types.
+func (r *Resolver) checkResponse(msg *message, t DNSType, opts queryOptions) (*message, error) {
+	if r.RequireAuthenticatedData && !msg.header.AuthenticatedData {
+		return nil, ErrNotAuthenticated
+	}
+
+	if r.RejectPrivateAddrs && msg.hasBogon() {
+		return nil, ErrPrivateAddr
+	}
+
+	if r.ReportNoData && !msg.hasAnswer(append([]DNSType{t}, opts.moreTypes...)) {
+		return msg, newNoDataError(msg)
+	}
+
+	return msg, nil
+}
+
+// queryOptions returns the given options, completed with the ones from the
+// resolver's configuration.
+// Returns ErrInvalidSubnet if r.ClientSubnet is invalid.
+func (r *Resolver) queryOptions(opts queryOptions) (queryOptions, error) {
+	opts.zeroID = r.ZeroID
+	opts.pad = r.Pad
+	opts.dnssecOK = r.DNSSECOK || r.RequireAuthenticatedData
+	opts.validate = opts.validate || r.RequireAuthenticatedData
+	opts.randomizeCase = r.Randomize0x20
+	if r.ClientSubnet != nil {
+		ecs, err := ecsOption(r.ClientSubnet)
+		if err != nil {
+			return opts, err
+		}
+		opts.ednsOptions = append(opts.ednsOptions, ecs)
+	}
+
+	return opts, nil
+}
+
+// exchange encodes a DNS query using the given options, sends it over HTTPS
+// (or with r.Exchanger if it's set) then parses the response, signing the
+// query and verifying the response if the resolver is configured to use TSIG.
+// If the resolver is configured to use the JSON format, the lookup is
+// performed using the JSON API instead.
+// r.OnQuery and r.OnResponse are called before and after the exchange, if set.
+func (r *Resolver) exchange(ctx context.Context, fqdn string, t DNSType, c DNSClass, opts queryOptions) (msg *message, err error) {
+	if r.OnQuery != nil {
+		r.OnQuery(fqdn, t)
+	}
+	if r.OnResponse != nil {
+		start := time.Now()
+		defer func() {
+			r.OnResponse(fqdn, t, time.Since(start), err)
+		}()
+	}
+
+	if r.Format == FormatJSON {
+		if c != IN {
+			return nil, ErrJSONClass
+		}
+
+		res, err := r.exchangeJSON(ctx, fqdn, t)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseJSONResponse(res, parseOptions{bestEffort: r.BestEffort, normalizeNames: r.NormalizeNames})
+	}
+
+	q, err := encodeQuery(fqdn, t, c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var mac []byte
+	if r.TSIG != nil {
+		var err error
+		if q, mac, err = r.TSIG.sign(q); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := r.exchangeQuery(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.TSIG != nil {
+		if err = r.TSIG.verify(res, mac); err != nil {
+			return nil, err
+		}
+	}
+
+	// Read the name back from the query, since it's in the same form as the
+	// response's question should be, i.e. without any trailing dot, and with
+	// the case randomized if the resolver uses 0x20 encoding.
+	qname, _, err := (&parser{res: q}).parseName(q[DNSMsgHeaderLen:])
+	if err != nil {
+		return nil, err
+	}
+
+	popts := parseOptions{
+		bestEffort:     r.BestEffort,
+		checkID:        true,
+		id:             binary.BigEndian.Uint16(q[0:2]),
+		checkQuestion:  true,
+		qname:          qname,
+		qtype:          t,
+		qclass:         c,
+		moreQTypes:     opts.moreTypes,
+		checkCase:      opts.randomizeCase,
+		normalizeNames: r.NormalizeNames,
+	}
+
+	return parseResponse(res, popts)
+}
+
+// Lookup performs a DoH lookup on records of the given type for the given
+// FQDN, bounded by the given context. It allows looking up types which don't
+// have a dedicated method.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Each record is one of the *XRecord types of this package, depending on t, or
+// nil if this package doesn't support parsing records of that type.
 // Returns an error if something went wrong at the network level, or when
-// parsing the response headers, or if the resolver's class isn't IN.
+// parsing the response headers, or ErrUnsupportedQueryType if t is AXFR or
+// IXFR, without sending any query, or ErrPrivateAddr if r.RejectPrivateAddrs
+// is true and an A or AAAA answer has a reserved address.
+func (r *Resolver) Lookup(ctx context.Context, fqdn string, t DNSType) (recs []Record, ttls []uint32, err error) {
+	recs, ttls, _, err = r.lookupRecords(ctx, fqdn, t, r.class(), queryOptions{})
+	return
+}
+
+// LookupNoCache is the same as Lookup, but always sends a query to the server
+// instead of answering from r.Cache, e.g. in order to check that a change to
+// a record has propagated. The response is still cached, replacing the one
+// that was cached if any.
+func (r *Resolver) LookupNoCache(ctx context.Context, fqdn string, t DNSType) (recs []Record, ttls []uint32, err error) {
+	recs, ttls, _, err = r.lookupRecords(ctx, fqdn, t, r.class(), queryOptions{noCache: true})
+	return
+}
+
+// lookupRecords performs a DoH lookup on records of the given type and class
+// for the given FQDN, encoding the query with the given options.
+// Returns the records and TTLs, as well as the message they've been read from.
+func (r *Resolver) lookupRecords(ctx context.Context, fqdn string, t DNSType, c DNSClass, opts queryOptions) (recs []Record, ttls []uint32, msg *message, err error) {
+	msg, err = r.lookupOpts(ctx, fqdn, t, c, opts)
+	if err != nil && msg == nil {
+		return
+	}
+
+	recs = make([]Record, 0)
+	ttls = make([]uint32, 0)
+
+	for _, a := range msg.answers {
+		if a.t == t {
+			recs = append(recs, a.parsed)
+			ttls = append(ttls, a.ttl)
+		}
+	}
+
+	return
+}
+
+// lookupParsed performs a DoH lookup on records of the given type for the
+// given FQDN, bounded by the given context, the same way Lookup does, but only
+// returns the records this package could parse, which are therefore all of
+// the *XRecord type matching t. The methods dedicated to a type are built on
+// it.
+func (r *Resolver) lookupParsed(ctx context.Context, fqdn string, t DNSType) (recs []Record, ttls []uint32, err error) {
+	recs, ttls, _, err = r.lookupRecords(ctx, fqdn, t, r.class(), queryOptions{})
+	recs, ttls = parsedRecords(recs, ttls)
+	return
+}
+
+// parsedRecords returns the given records and their TTLs, without the records
+// this package couldn't parse (i.e. the nil ones).
+func parsedRecords(recs []Record, ttls []uint32) ([]Record, []uint32) {
+	if recs == nil {
+		return nil, nil
+	}
+
+	parsedRecs := make([]Record, 0, len(recs))
+	parsedTTLs := make([]uint32, 0, len(ttls))
+	for i, rec := range recs {
+		if rec != nil {
+			parsedRecs = append(parsedRecs, rec)
+			parsedTTLs = append(parsedTTLs, ttls[i])
+		}
+	}
+
+	return parsedRecs, parsedTTLs
+}
+
+// LookupRaw performs a DoH lookup on records of the given type and class for
+// the given FQDN, bounded by the given context, and returns the body of the
+// server's response without parsing it, e.g. in order to inspect a response
+// which can't be parsed. If the resolver is configured to use the JSON format,
+// the body is the JSON document the server responded with.
+// The answer isn't cached, nor verified if the resolver is configured to use
+// TSIG.
+// Returns an error if the query couldn't be built, e.g. ErrUnsupportedQueryType
+// for zone transfers, or if something went wrong at the network level.
+func (r *Resolver) LookupRaw(ctx context.Context, fqdn string, t DNSType, c DNSClass) ([]byte, error) {
+	if r.Host == "" && r.Exchanger == nil {
+		return nil, ErrNoHost
+	}
+
+	if err := checkQueryType(t); err != nil {
+		return nil, err
+	}
+
+	if r.Format == FormatJSON {
+		if c != IN {
+			return nil, ErrJSONClass
+		}
+
+		return r.exchangeJSON(ctx, fqdn, t)
+	}
+
+	opts, err := r.queryOptions(queryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := encodeQuery(fqdn, t, c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.TSIG != nil {
+		if q, _, err = r.TSIG.sign(q); err != nil {
+			return nil, err
+		}
+	}
+
+	return r.exchangeQuery(ctx, q)
+}
+
+// LookupA performs a DoH lookup on A records for the given FQDN.
+// It is equivalent to LookupACtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
 func (r *Resolver) LookupA(fqdn string) (recs []*ARecord, ttls []uint32, err error) {
-	if r.Class != IN && r.Class != ANYCLASS {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupACtx(ctx, fqdn)
+}
+
+// LookupACtx performs a DoH lookup on A records for the given FQDN, bounded by
+// the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers, or if the resolver's class isn't IN, or if
+// r.RejectPrivateAddrs is true and an answer has a reserved address.
+func (r *Resolver) LookupACtx(ctx context.Context, fqdn string) (recs []*ARecord, ttls []uint32, err error) {
+	recs, ttls, _, err = r.lookupA(ctx, fqdn, queryOptions{})
+	return
+}
+
+// LookupAValidated performs a DoH lookup on A records for the given FQDN,
+// bounded by the given context, and asks the server to validate the answers
+// using DNSSEC.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on,
+// as well as whether the server reported the answers as authenticated (i.e. if
+// it set the AD bit in its response). Note that this is only meaningful if the
+// connection to the server is trusted, and that the answers are returned even
+// if they weren't authenticated.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers, or if the resolver's class isn't IN, or if
+// r.RejectPrivateAddrs is true and an answer has a reserved address.
+func (r *Resolver) LookupAValidated(ctx context.Context, fqdn string) (recs []*ARecord, ttls []uint32, authenticated bool, err error) {
+	recs, ttls, msg, err := r.lookupA(ctx, fqdn, queryOptions{validate: true})
+	if msg != nil {
+		authenticated = msg.header.AuthenticatedData
+	}
+	return
+}
+
+// lookupA performs a DoH lookup on A records for the given FQDN, encoding the
+// query with the given options.
+// Returns the records and TTLs, as well as the message they've been read from.
+func (r *Resolver) lookupA(ctx context.Context, fqdn string, opts queryOptions) (recs []*ARecord, ttls []uint32, msg *message, err error) {
+	if c := r.class(); c != IN && c != ANYCLASS {
 		err = ErrNotIN
 		return
 	}
 
-	answers, err := r.lookup(fqdn, A, IN)
-	if err != nil {
+	rrs, ttls, msg, err := r.lookupRecords(ctx, fqdn, A, IN, opts)
+	rrs, ttls = parsedRecords(rrs, ttls)
+	if rrs == nil {
 		return
 	}
 
-	recs = make([]*ARecord, 0)
-	ttls = make([]uint32, 0)
+	recs = make([]*ARecord, len(rrs))
+	for i, rec := range rrs {
+		recs[i] = rec.(*ARecord)
+	}
 
-	for _, a := range answers {
-		if a.t == A {
-			recs = append(recs, a.parsed.(*ARecord))
-			ttls = append(ttls, a.ttl)
-		}
+	if n := r.rotation(len(recs)); n > 0 {
+		recs = append(recs[n:], recs[:n]...)
+		ttls = append(ttls[n:], ttls[:n]...)
 	}
 
 	return
 }
 
+// rotation returns the number of positions to rotate the given count of
+// answers by, which increases with every call if r.RotateAnswers is true, and
+// is always zero otherwise.
+func (r *Resolver) rotation(count int) int {
+	if !r.RotateAnswers || count < 2 {
+		return 0
+	}
+
+	return int((atomic.AddUint32(&r.rotations, 1) - 1) % uint32(count))
+}
+
 // LookupAAAA performs a DoH lookup on AAAA records for the given FQDN.
+// It is equivalent to LookupAAAACtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupAAAA(fqdn string) (recs []*AAAARecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupAAAACtx(ctx, fqdn)
+}
+
+// LookupAAAACtx performs a DoH lookup on AAAA records for the given FQDN,
+// bounded by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
-// parsing the response headers, or if the resolver's class isn't IN.
-func (r *Resolver) LookupAAAA(fqdn string) (recs []*AAAARecord, ttls []uint32, err error) {
-	if r.Class != IN && r.Class != ANYCLASS {
+// parsing the response headers, or if the resolver's class isn't IN, or if
+// r.RejectPrivateAddrs is true and an answer has a reserved address.
+func (r *Resolver) LookupAAAACtx(ctx context.Context, fqdn string) (recs []*AAAARecord, ttls []uint32, err error) {
+	recs, ttls, _, err = r.lookupAAAA(ctx, fqdn)
+	return
+}
+
+// lookupAAAA performs a DoH lookup on AAAA records for the given FQDN.
+// Returns the records and TTLs, as well as the message they've been read from.
+func (r *Resolver) lookupAAAA(ctx context.Context, fqdn string) (recs []*AAAARecord, ttls []uint32, msg *message, err error) {
+	if c := r.class(); c != IN && c != ANYCLASS {
 		err = ErrNotIN
 		return
 	}
 
-	answers, err := r.lookup(fqdn, AAAA, IN)
-	if err != nil {
+	rrs, ttls, msg, err := r.lookupRecords(ctx, fqdn, AAAA, IN, queryOptions{})
+	rrs, ttls = parsedRecords(rrs, ttls)
+	if rrs == nil {
 		return
 	}
 
-	recs = make([]*AAAARecord, 0)
-	ttls = make([]uint32, 0)
+	recs = make([]*AAAARecord, len(rrs))
+	for i, rec := range rrs {
+		recs[i] = rec.(*AAAARecord)
+	}
 
-	for _, a := range answers {
-		if a.t == AAAA {
-			recs = append(recs, a.parsed.(*AAAARecord))
-			ttls = append(ttls, a.ttl)
-		}
+	if n := r.rotation(len(recs)); n > 0 {
+		recs = append(recs[n:], recs[:n]...)
+		ttls = append(ttls[n:], ttls[:n]...)
 	}
 
 	return
 }
 
 // LookupCNAME performs a DoH lookup on CNAME records for the given FQDN.
+// It is equivalent to LookupCNAMECtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupCNAME(fqdn string) (recs []*CNAMERecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupCNAMECtx(ctx, fqdn)
+}
+
+// LookupCNAMECtx performs a DoH lookup on CNAME records for the given FQDN,
+// bounded by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupCNAME(fqdn string) (recs []*CNAMERecord, ttls []uint32, err error) {
-	answers, err := r.lookup(fqdn, CNAME, IN)
-	if err != nil {
-		return
+func (r *Resolver) LookupCNAMECtx(ctx context.Context, fqdn string) (recs []*CNAMERecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, CNAME)
+	if rrs != nil {
+		recs = make([]*CNAMERecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*CNAMERecord)
+		}
 	}
 
-	recs = make([]*CNAMERecord, 0)
-	ttls = make([]uint32, 0)
+	return
+}
 
-	for _, a := range answers {
-		if a.t == CNAME {
-			recs = append(recs, a.parsed.(*CNAMERecord))
-			ttls = append(ttls, a.ttl)
+// LookupMX performs a DoH lookup on MX records for the given FQDN.
+// It is equivalent to LookupMXCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupMX(fqdn string) (recs []*MXRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupMXCtx(ctx, fqdn)
+}
+
+// LookupMXCtx performs a DoH lookup on MX records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupMXCtx(ctx context.Context, fqdn string) (recs []*MXRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, MX)
+	if rrs != nil {
+		recs = make([]*MXRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*MXRecord)
 		}
 	}
 
 	return
 }
 
-// LookupMX performs a DoH lookup on CNAME records for the given FQDN.
+// LookupNS performs a DoH lookup on NS records for the given FQDN.
+// It is equivalent to LookupNSCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupNS(fqdn string) (recs []*NSRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupNSCtx(ctx, fqdn)
+}
+
+// LookupNSCtx performs a DoH lookup on NS records for the given FQDN,
+// bounded by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupMX(fqdn string) (recs []*MXRecord, ttls []uint32, err error) {
-	answers, err := r.lookup(fqdn, MX, IN)
-	if err != nil {
-		return
+func (r *Resolver) LookupNSCtx(ctx context.Context, fqdn string) (recs []*NSRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, NS)
+	if rrs != nil {
+		recs = make([]*NSRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*NSRecord)
+		}
 	}
 
-	recs = make([]*MXRecord, 0)
-	ttls = make([]uint32, 0)
+	return
+}
 
-	for _, a := range answers {
-		if a.t == MX {
-			recs = append(recs, a.parsed.(*MXRecord))
-			ttls = append(ttls, a.ttl)
+// LookupTXT performs a DoH lookup on TXT records for the given FQDN.
+// It is equivalent to LookupTXTCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupTXT(fqdn string) (recs []*TXTRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupTXTCtx(ctx, fqdn)
+}
+
+// LookupTXTCtx performs a DoH lookup on TXT records for the given FQDN, bounded
+// by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupTXTCtx(ctx context.Context, fqdn string) (recs []*TXTRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, TXT)
+	if rrs != nil {
+		recs = make([]*TXTRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*TXTRecord)
 		}
 	}
 
 	return
 }
 
-// LookupNS performs a DoH lookup on CNAME records for the given FQDN.
+// LookupTXTValues performs a DoH lookup on TXT records for the given FQDN,
+// bounded by the given context, and returns the value of each record, i.e. the
+// concatenation of its character-strings, e.g. to read SPF policies or
+// verification tokens.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupTXTValues(ctx context.Context, fqdn string) ([]string, error) {
+	recs, _, err := r.LookupTXTCtx(ctx, fqdn)
+	if recs == nil {
+		return nil, err
+	}
+
+	values := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		values = append(values, rec.TXT)
+	}
+
+	return values, err
+}
+
+// LookupSRV performs a DoH lookup on SRV records for the given FQDN.
+// It is equivalent to LookupSRVCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupSRV(fqdn string) (recs []*SRVRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupSRVCtx(ctx, fqdn)
+}
+
+// LookupSRVCtx performs a DoH lookup on SRV records for the given FQDN, bounded
+// by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupNS(fqdn string) (recs []*NSRecord, ttls []uint32, err error) {
-	answers, err := r.lookup(fqdn, NS, IN)
-	if err != nil {
-		return
+func (r *Resolver) LookupSRVCtx(ctx context.Context, fqdn string) (recs []*SRVRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, SRV)
+	if rrs != nil {
+		recs = make([]*SRVRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*SRVRecord)
+		}
 	}
 
-	recs = make([]*NSRecord, 0)
-	ttls = make([]uint32, 0)
+	return
+}
 
-	for _, a := range answers {
-		if a.t == NS {
-			recs = append(recs, a.parsed.(*NSRecord))
-			ttls = append(ttls, a.ttl)
+// LookupService performs a DoH lookup on SRV records for the given service,
+// network and domain.
+// It is equivalent to LookupServiceCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupService(service, network, domain string) (recs []*SRVRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupServiceCtx(ctx, service, network, domain)
+}
+
+// LookupServiceCtx performs a DoH lookup on SRV records for the given service,
+// network and domain, bounded by the given context. network's value is
+// expected to be in the likes of "udp", "tcp" and so on. Under the hood, it
+// builds a FQDN of the form _service._network.domain and calls r.LookupSRVCtx
+// with it.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupServiceCtx(ctx context.Context, service, network, domain string) (recs []*SRVRecord, ttls []uint32, err error) {
+	return r.LookupSRVCtx(ctx, "_"+service+"._"+network+"."+domain)
+}
+
+// LookupSOA performs a DoH lookup on SOA records for the given FQDN.
+// It is equivalent to LookupSOACtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupSOA(fqdn string) (recs []*SOARecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupSOACtx(ctx, fqdn)
+}
+
+// LookupSOACtx performs a DoH lookup on SOA records for the given FQDN, bounded
+// by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupSOACtx(ctx context.Context, fqdn string) (recs []*SOARecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, SOA)
+	if rrs != nil {
+		recs = make([]*SOARecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*SOARecord)
 		}
 	}
 
 	return
 }
 
-// LookupTXT performs a DoH lookup on TXT records for the given FQDN.
+// LookupPTR performs a DoH lookup on PTR records for the given FQDN.
+// It is equivalent to LookupPTRCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupPTR(fqdn string) (recs []*PTRRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupPTRCtx(ctx, fqdn)
+}
+
+// LookupPTRCtx performs a DoH lookup on PTR records for the given FQDN, bounded
+// by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupTXT(fqdn string) (recs []*TXTRecord, ttls []uint32, err error) {
-	answers, err := r.lookup(fqdn, TXT, IN)
-	if err != nil {
-		return
+func (r *Resolver) LookupPTRCtx(ctx context.Context, fqdn string) (recs []*PTRRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, PTR)
+	if rrs != nil {
+		recs = make([]*PTRRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*PTRRecord)
+		}
 	}
 
-	recs = make([]*TXTRecord, 0)
-	ttls = make([]uint32, 0)
+	return
+}
 
-	for _, a := range answers {
-		if a.t == TXT {
-			recs = append(recs, a.parsed.(*TXTRecord))
-			ttls = append(ttls, a.ttl)
+// LookupMB performs a DoH lookup on MB records for the given FQDN.
+// It is equivalent to LookupMBCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupMB(fqdn string) (recs []*MBRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupMBCtx(ctx, fqdn)
+}
+
+// LookupMBCtx performs a DoH lookup on MB records for the given FQDN, bounded
+// by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupMBCtx(ctx context.Context, fqdn string) (recs []*MBRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, MB)
+	if rrs != nil {
+		recs = make([]*MBRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*MBRecord)
 		}
 	}
 
 	return
 }
 
-// LookupSRV performs a DoH lookup on SRV records for the given FQDN.
+// LookupMG performs a DoH lookup on MG records for the given FQDN.
+// It is equivalent to LookupMGCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupMG(fqdn string) (recs []*MGRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupMGCtx(ctx, fqdn)
+}
+
+// LookupMGCtx performs a DoH lookup on MG records for the given FQDN, bounded
+// by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupSRV(fqdn string) (recs []*SRVRecord, ttls []uint32, err error) {
-	answers, err := r.lookup(fqdn, SRV, IN)
-	if err != nil {
-		return
+func (r *Resolver) LookupMGCtx(ctx context.Context, fqdn string) (recs []*MGRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, MG)
+	if rrs != nil {
+		recs = make([]*MGRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*MGRecord)
+		}
 	}
 
-	recs = make([]*SRVRecord, 0)
-	ttls = make([]uint32, 0)
+	return
+}
 
-	for _, a := range answers {
-		if a.t == SRV {
-			recs = append(recs, a.parsed.(*SRVRecord))
-			ttls = append(ttls, a.ttl)
+// LookupMR performs a DoH lookup on MR records for the given FQDN.
+// It is equivalent to LookupMRCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupMR(fqdn string) (recs []*MRRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupMRCtx(ctx, fqdn)
+}
+
+// LookupMRCtx performs a DoH lookup on MR records for the given FQDN, bounded
+// by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupMRCtx(ctx context.Context, fqdn string) (recs []*MRRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, MR)
+	if rrs != nil {
+		recs = make([]*MRRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*MRRecord)
 		}
 	}
 
 	return
 }
 
-// LookupService performs a DoH lookup on SRV records for the given service,
-// network and domain. network's value is expected to be in the likes of "udp",
-// "tcp" and so on. Under the hood, it builds a FQDN of the form
-// _service._network.domain and calls r.LookupSRV with it.
+// LookupCAA performs a DoH lookup on CAA records for the given FQDN.
+// It is equivalent to LookupCAACtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupCAA(fqdn string) (recs []*CAARecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupCAACtx(ctx, fqdn)
+}
+
+// LookupCAACtx performs a DoH lookup on CAA records for the given FQDN,
+// bounded by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupService(service, network, domain string) (recs []*SRVRecord, ttls []uint32, err error) {
-	return r.LookupSRV("_" + service + "._" + network + "." + domain)
+func (r *Resolver) LookupCAACtx(ctx context.Context, fqdn string) (recs []*CAARecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, CAA)
+	if rrs != nil {
+		recs = make([]*CAARecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*CAARecord)
+		}
+	}
+
+	return
 }
 
-// LookupSOA performs a DoH lookup on SOA records for the given FQDN.
+// LookupNAPTR performs a DoH lookup on NAPTR records for the given FQDN.
+// It is equivalent to LookupNAPTRCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupNAPTR(fqdn string) (recs []*NAPTRRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupNAPTRCtx(ctx, fqdn)
+}
+
+// LookupNAPTRCtx performs a DoH lookup on NAPTR records for the given FQDN,
+// bounded by the given context.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupSOA(fqdn string) (recs []*SOARecord, ttls []uint32, err error) {
-	answers, err := r.lookup(fqdn, SOA, IN)
-	if err != nil {
-		return
+func (r *Resolver) LookupNAPTRCtx(ctx context.Context, fqdn string) (recs []*NAPTRRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, NAPTR)
+	if rrs != nil {
+		recs = make([]*NAPTRRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*NAPTRRecord)
+		}
 	}
 
-	recs = make([]*SOARecord, 0)
-	ttls = make([]uint32, 0)
+	return
+}
 
-	for _, a := range answers {
-		if a.t == SOA {
-			recs = append(recs, a.parsed.(*SOARecord))
-			ttls = append(ttls, a.ttl)
+// LookupTLSA performs a DoH lookup on TLSA records for the given FQDN.
+// It is equivalent to LookupTLSACtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupTLSA(fqdn string) (recs []*TLSARecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupTLSACtx(ctx, fqdn)
+}
+
+// LookupTLSACtx performs a DoH lookup on TLSA records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupTLSACtx(ctx context.Context, fqdn string) (recs []*TLSARecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, TLSA)
+	if rrs != nil {
+		recs = make([]*TLSARecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*TLSARecord)
 		}
 	}
 
 	return
 }
 
-// LookupPTR performs a DoH lookup on PTR records for the given FQDN.
+// LookupTLSAService performs a DoH lookup on TLSA records for the given port,
+// protocol and domain.
+// It is equivalent to LookupTLSAServiceCtx with a background context, bounded
+// by r.DefaultTimeout if it's set.
+func (r *Resolver) LookupTLSAService(port int, proto, name string) (recs []*TLSARecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupTLSAServiceCtx(ctx, port, proto, name)
+}
+
+// LookupTLSAServiceCtx performs a DoH lookup on TLSA records for the given
+// port, protocol and domain, bounded by the given context. proto's value is
+// expected to be in the likes of "tcp", "udp" and so on. Under the hood, it
+// builds a FQDN of the form _port._proto.name, as described in section 3 of
+// RFC 6698, and calls r.LookupTLSACtx with it.
 // Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
 // Returns an error if something went wrong at the network level, or when
 // parsing the response headers.
-func (r *Resolver) LookupPTR(fqdn string) (recs []*PTRRecord, ttls []uint32, err error) {
-	answers, err := r.lookup(fqdn, PTR, IN)
-	if err != nil {
-		return
+func (r *Resolver) LookupTLSAServiceCtx(ctx context.Context, port int, proto, name string) (recs []*TLSARecord, ttls []uint32, err error) {
+	return r.LookupTLSACtx(ctx, "_"+strconv.Itoa(port)+"._"+proto+"."+name)
+}
+
+// LookupSSHFP performs a DoH lookup on SSHFP records for the given FQDN.
+// It is equivalent to LookupSSHFPCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupSSHFP(fqdn string) (recs []*SSHFPRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupSSHFPCtx(ctx, fqdn)
+}
+
+// LookupSSHFPCtx performs a DoH lookup on SSHFP records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupSSHFPCtx(ctx context.Context, fqdn string) (recs []*SSHFPRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, SSHFP)
+	if rrs != nil {
+		recs = make([]*SSHFPRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*SSHFPRecord)
+		}
 	}
 
-	recs = make([]*PTRRecord, 0)
-	ttls = make([]uint32, 0)
+	return
+}
 
-	for _, a := range answers {
-		if a.t == PTR {
-			recs = append(recs, a.parsed.(*PTRRecord))
-			ttls = append(ttls, a.ttl)
+// LookupDS performs a DoH lookup on DS records for the given FQDN.
+// It is equivalent to LookupDSCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupDS(fqdn string) (recs []*DSRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupDSCtx(ctx, fqdn)
+}
+
+// LookupDSCtx performs a DoH lookup on DS records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupDSCtx(ctx context.Context, fqdn string) (recs []*DSRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, DS)
+	if rrs != nil {
+		recs = make([]*DSRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*DSRecord)
+		}
+	}
+
+	return
+}
+
+// LookupDNSKEY performs a DoH lookup on DNSKEY records for the given FQDN.
+// It is equivalent to LookupDNSKEYCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupDNSKEY(fqdn string) (recs []*DNSKEYRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupDNSKEYCtx(ctx, fqdn)
+}
+
+// LookupDNSKEYCtx performs a DoH lookup on DNSKEY records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupDNSKEYCtx(ctx context.Context, fqdn string) (recs []*DNSKEYRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, DNSKEY)
+	if rrs != nil {
+		recs = make([]*DNSKEYRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*DNSKEYRecord)
+		}
+	}
+
+	return
+}
+
+// LookupURI performs a DoH lookup on URI records for the given FQDN.
+// It is equivalent to LookupURICtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupURI(fqdn string) (recs []*URIRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupURICtx(ctx, fqdn)
+}
+
+// LookupURICtx performs a DoH lookup on URI records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupURICtx(ctx context.Context, fqdn string) (recs []*URIRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, URI)
+	if rrs != nil {
+		recs = make([]*URIRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*URIRecord)
+		}
+	}
+
+	return
+}
+
+// LookupDNAME performs a DoH lookup on DNAME records for the given FQDN.
+// It is equivalent to LookupDNAMECtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupDNAME(fqdn string) (recs []*DNAMERecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupDNAMECtx(ctx, fqdn)
+}
+
+// LookupDNAMECtx performs a DoH lookup on DNAME records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupDNAMECtx(ctx context.Context, fqdn string) (recs []*DNAMERecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, DNAME)
+	if rrs != nil {
+		recs = make([]*DNAMERecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*DNAMERecord)
+		}
+	}
+
+	return
+}
+
+// LookupSPF performs a DoH lookup on SPF records for the given FQDN.
+// It is equivalent to LookupSPFCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupSPF(fqdn string) (recs []*SPFRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupSPFCtx(ctx, fqdn)
+}
+
+// LookupSPFCtx performs a DoH lookup on SPF records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupSPFCtx(ctx context.Context, fqdn string) (recs []*SPFRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, SPF)
+	if rrs != nil {
+		recs = make([]*SPFRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*SPFRecord)
+		}
+	}
+
+	return
+}
+
+// LookupSVCB performs a DoH lookup on SVCB records for the given FQDN.
+// It is equivalent to LookupSVCBCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupSVCB(fqdn string) (recs []*SVCBRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupSVCBCtx(ctx, fqdn)
+}
+
+// LookupSVCBCtx performs a DoH lookup on SVCB records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupSVCBCtx(ctx context.Context, fqdn string) (recs []*SVCBRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, SVCB)
+	if rrs != nil {
+		recs = make([]*SVCBRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*SVCBRecord)
+		}
+	}
+
+	return
+}
+
+// LookupHTTPS performs a DoH lookup on HTTPS records for the given FQDN.
+// It is equivalent to LookupHTTPSCtx with a background context, bounded by
+// r.DefaultTimeout if it's set.
+func (r *Resolver) LookupHTTPS(fqdn string) (recs []*HTTPSRecord, ttls []uint32, err error) {
+	ctx, cancel := r.defaultContext()
+	defer cancel()
+	return r.LookupHTTPSCtx(ctx, fqdn)
+}
+
+// LookupHTTPSCtx performs a DoH lookup on HTTPS records for the given FQDN,
+// bounded by the given context.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers.
+func (r *Resolver) LookupHTTPSCtx(ctx context.Context, fqdn string) (recs []*HTTPSRecord, ttls []uint32, err error) {
+	rrs, ttls, err := r.lookupParsed(ctx, fqdn, HTTPS)
+	if rrs != nil {
+		recs = make([]*HTTPSRecord, len(rrs))
+		for i, rec := range rrs {
+			recs[i] = rec.(*HTTPSRecord)
 		}
 	}
 
@@ -0,0 +1,927 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc allows using a function as a http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newStubResolver returns a resolver which doesn't send its queries over the
+// network but answers them with the given function instead.
+func newStubResolver(answer func(q []byte) []byte) *Resolver {
+	transport := func(req *http.Request) (*http.Response, error) {
+		q, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/dns-message"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(answer(q))),
+			Request:    req,
+		}, nil
+	}
+
+	return &Resolver{
+		Host:       "doh.example.com",
+		Class:      IN,
+		HTTPClient: &http.Client{Transport: roundTripperFunc(transport)},
+	}
+}
+
+// buildResponse builds a response to the given query, with the given resource
+// records as its answer section.
+func buildResponse(q []byte, answers ...[]byte) []byte {
+	res := make([]byte, len(q))
+	copy(res, q)
+
+	// QR = 1 (response), RA = 1 (recursion available)
+	res[2] |= 1 << 7
+	res[3] |= 1 << 7
+	binary.BigEndian.PutUint16(res[6:8], uint16(len(answers)))
+
+	for _, a := range answers {
+		res = append(res, a...)
+	}
+
+	return res
+}
+
+// withAuthority appends the given resource records to the given response as
+// its authority section.
+func withAuthority(res []byte, rrs ...[]byte) []byte {
+	binary.BigEndian.PutUint16(res[8:10], uint16(len(rrs)))
+	for _, rr := range rrs {
+		res = append(res, rr...)
+	}
+	return res
+}
+
+// buildRR builds a resource record of the given type, TTL and RDATA, which name
+// is a compression pointer to the question's name.
+func buildRR(t DNSType, ttl uint32, rdata []byte) []byte {
+	rr := []byte{0xc0, DNSMsgHeaderLen}
+	rr = append(rr, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(rr[2:4], uint16(t))
+	binary.BigEndian.PutUint16(rr[4:6], uint16(IN))
+	binary.BigEndian.PutUint32(rr[6:10], ttl)
+	binary.BigEndian.PutUint16(rr[10:12], uint16(len(rdata)))
+	return append(rr, rdata...)
+}
+
+func TestLookupA(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+
+	recs, ttls, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA || ttls[0] != 300 {
+		t.Fail()
+	}
+}
+
+func TestLookupRecordTTL(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(validResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	r := newStubResolver(func(q []byte) []byte {
+		// Answer with the query's ID.
+		copy(res[0:2], q[0:2])
+		return res
+	})
+
+	recs, ttls, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != validACount || recs[0].TTL != ttls[0] || recs[0].TTL == 0 {
+		t.Fail()
+	}
+}
+
+func TestLookup(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(
+			q,
+			buildRR(CNAME, 300, []byte{4, 'b', 'l', 'o', 'g', 0xc0, DNSMsgHeaderLen}),
+			buildRR(A, 300, []byte{51, 38, 47, 191}),
+		)
+	})
+
+	recs, ttls, err := r.Lookup(context.Background(), "example.com", A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || len(ttls) != 1 {
+		t.FailNow()
+	}
+
+	a, ok := recs[0].(*ARecord)
+	if !ok || a.IP4 != expectedA {
+		t.Fail()
+	}
+}
+
+func TestLookupZoneTransfer(t *testing.T) {
+	var queries int
+	r := newStubResolver(func(q []byte) []byte {
+		queries++
+		return buildResponse(q)
+	})
+
+	for _, rtype := range []DNSType{252, 251} {
+		if _, _, err := r.Lookup(context.Background(), "example.com", rtype); err != ErrUnsupportedQueryType {
+			t.Errorf("unexpected error %v for type %d", err, rtype)
+		}
+	}
+
+	if _, err := r.LookupRaw(context.Background(), "example.com", 252, IN); err != ErrUnsupportedQueryType {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if queries != 0 {
+		t.Errorf("expected no query, got %d", queries)
+	}
+}
+
+func TestLookupIDMismatch(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		res[0] ^= 0xff
+		return res
+	})
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrIDMismatch {
+		t.Fail()
+	}
+}
+
+func TestLookupTXTValues(t *testing.T) {
+	multi, err := base64.RawStdEncoding.DecodeString(rdataTXTMulti)
+	if err != nil {
+		t.FailNow()
+	}
+	single, err := base64.RawStdEncoding.DecodeString(rdataTXT)
+	if err != nil {
+		t.FailNow()
+	}
+
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(TXT, 300, multi), buildRR(TXT, 300, single))
+	})
+
+	values, err := r.LookupTXTValues(context.Background(), "abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The character-strings are joined within each record, but each record
+	// has its own value.
+	expected := []string{expectedTXTMultiFirst + expectedTXTMultiSecond, expectedTXT}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values %q", values)
+	}
+}
+
+func TestLookupClass(t *testing.T) {
+	var qclass DNSClass
+	r := newStubResolver(func(q []byte) []byte {
+		qclass = DNSClass(binary.BigEndian.Uint16(q[len(q)-2:]))
+
+		rr := buildRR(TXT, 0, append([]byte{5}, "9.18."...))
+		binary.BigEndian.PutUint16(rr[4:6], uint16(CH))
+		return buildResponse(q, rr)
+	})
+	r.Class = CH
+
+	recs, _, err := r.LookupTXT("version.bind")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if qclass != CH || len(recs) != 1 || recs[0].TXT != "9.18." {
+		t.Errorf("unexpected class %s or records %v", qclass, recs)
+	}
+
+	// A lookups are only possible in the IN class.
+	if _, _, err := r.LookupA("version.bind"); err != ErrNotIN {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Without any class set, lookups are performed with IN.
+	r.Class = 0
+	if _, _, err := r.LookupTXT("example.com"); err != nil || qclass != IN {
+		t.Errorf("unexpected error %v or class %s", err, qclass)
+	}
+}
+
+func TestLookupQuestionMismatch(t *testing.T) {
+	other := mustEncodeQuery("blog.brendan.abolivier.bzh", A, IN, queryOptions{})
+	r := newStubResolver(func(q []byte) []byte {
+		// Answer with the query's ID, but the question of another query.
+		res := buildResponse(other, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		copy(res[0:2], q[0:2])
+		return res
+	})
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrQuestionMismatch {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// The name is compared regardless of its case, but the type must match.
+	r = newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		res[DNSMsgHeaderLen+1] = 'B'
+		return res
+	})
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	r = newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q)
+		// QTYPE = AAAA
+		binary.BigEndian.PutUint16(res[len(res)-4:len(res)-2], uint16(AAAA))
+		return res
+	})
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrQuestionMismatch {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLookupErrorWithoutQuestion(t *testing.T) {
+	for _, rcode := range []int{0, 5} {
+		r := newStubResolver(func(q []byte) []byte {
+			// Respond with the query's header only, without the question.
+			res := buildResponse(q[:DNSMsgHeaderLen])
+			binary.BigEndian.PutUint16(res[4:6], 0)
+			res[3] |= byte(rcode)
+			return res
+		})
+
+		_, _, err := r.LookupA("brendan.abolivier.bzh")
+		if rcode == 0 && err != ErrQuestionMismatch {
+			t.Errorf("unexpected error %v for a successful response", err)
+		}
+
+		// The response code of a REFUSED response isn't hidden by the
+		// missing question.
+		var rcodeErr *RCodeError
+		if rcode != 0 && (!errors.As(err, &rcodeErr) || rcodeErr.Code != rcode) {
+			t.Errorf("unexpected error %v for RCODE %d", err, rcode)
+		}
+	}
+}
+
+func TestLookupTruncated(t *testing.T) {
+	for _, alwaysTruncated := range []bool{false, true} {
+		var queries [][]byte
+		r := newStubResolver(func(q []byte) []byte {
+			queries = append(queries, q)
+			qlen := len(mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{}))
+			res := buildResponse(q[:qlen], buildRR(A, 300, []byte{51, 38, 47, 191}))
+			binary.BigEndian.PutUint16(res[10:12], 0)
+			if len(queries) == 1 || alwaysTruncated {
+				// TC = 1
+				res[2] |= 1 << 1
+			}
+			return res
+		})
+
+		recs, _, err := r.LookupA("brendan.abolivier.bzh")
+		if len(queries) != 2 {
+			t.Fatalf("expected 2 queries, got %d", len(queries))
+		}
+
+		// The retry advertises the largest payload size in an OPT record.
+		retry := queries[1]
+		if binary.BigEndian.Uint16(retry[10:12]) != 1 ||
+			binary.BigEndian.Uint16(retry[len(retry)-8:len(retry)-6]) != maxEDNSPayloadSize {
+			t.Errorf("unexpected retry query %v", retry)
+		}
+
+		if alwaysTruncated {
+			if err != ErrTruncated {
+				t.Errorf("expected ErrTruncated, got %v", err)
+			}
+			continue
+		}
+
+		if err != nil || len(recs) != 1 {
+			t.Errorf("unexpected result %v, %v", recs, err)
+		}
+	}
+}
+
+func TestLookupDeadline(t *testing.T) {
+	r := newStubResolver(nil)
+	// Simulate a server that never replies.
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := r.LookupACtx(ctx, "brendan.abolivier.bzh")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fail()
+	}
+}
+
+func TestLookupDeadlineSeveralQueries(t *testing.T) {
+	// A chain of CNAME records, which takes a query per link to follow.
+	cnames := make(map[string]string)
+	for i := 0; i < maxCNAMEDepth; i++ {
+		cnames[fmt.Sprintf("%d.abolivier.bzh", i)] = fmt.Sprintf("%d.abolivier.bzh", i+1)
+	}
+
+	var calls int
+	r := newCNAMEResolver(cnames, &calls)
+	// Every query takes well under the deadline on its own, but following
+	// the whole chain takes longer than it.
+	stub := r.HTTPClient.Transport
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		select {
+		case <-time.After(30 * time.Millisecond):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		return stub.RoundTrip(req)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, _, err := r.LookupAFollow(ctx, "0.abolivier.bzh")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+
+	if calls < 2 || calls >= maxCNAMEDepth {
+		t.Errorf("unexpected number of queries %d", calls)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %s", elapsed)
+	}
+}
+
+func TestLookupCanceled(t *testing.T) {
+	r := newStubResolver(nil)
+	// Simulate a server that never replies.
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, _, err := r.LookupACtx(ctx, "brendan.abolivier.bzh")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled error, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fail()
+	}
+}
+
+func TestRejectPrivateAddrs(t *testing.T) {
+	addrs := [][]byte{
+		{192, 168, 1, 1},
+		{10, 0, 0, 1},
+		{127, 0, 0, 1},
+	}
+
+	for _, addr := range addrs {
+		r := newStubResolver(func(q []byte) []byte {
+			return buildResponse(
+				q,
+				buildRR(A, 300, []byte{51, 38, 47, 191}),
+				buildRR(A, 300, addr),
+			)
+		})
+
+		if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+			t.Fatal(err)
+		}
+
+		r.RejectPrivateAddrs = true
+		if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrPrivateAddr {
+			t.Errorf("expected ErrPrivateAddr for %v, got %v", addr, err)
+		}
+	}
+}
+
+func TestRejectPrivateAddrsAAAA(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(AAAA, 300, net.IPv6loopback))
+	})
+	r.RejectPrivateAddrs = true
+
+	if _, _, err := r.LookupAAAA("brendan.abolivier.bzh"); err != ErrPrivateAddr {
+		t.Errorf("expected ErrPrivateAddr, got %v", err)
+	}
+}
+
+func TestRejectPrivateAddrsGeneric(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{10, 0, 0, 1}))
+	})
+	r.Cache = NewCache(0)
+
+	// Cache the response before rejecting private addresses, so that the
+	// lookups are also checked when answered from the cache.
+	if _, _, err := r.Lookup(context.Background(), "brendan.abolivier.bzh", A); err != nil {
+		t.Fatal(err)
+	}
+
+	r.RejectPrivateAddrs = true
+
+	if _, _, err := r.Lookup(context.Background(), "brendan.abolivier.bzh", A); err != ErrPrivateAddr {
+		t.Errorf("Lookup: expected ErrPrivateAddr, got %v", err)
+	}
+
+	if _, err := r.LookupResponse(context.Background(), "brendan.abolivier.bzh", A); err != ErrPrivateAddr {
+		t.Errorf("LookupResponse: expected ErrPrivateAddr, got %v", err)
+	}
+
+	if _, err := r.LookupMulti(context.Background(), "brendan.abolivier.bzh", []DNSType{A, AAAA}); err != ErrPrivateAddr {
+		t.Errorf("LookupMulti: expected ErrPrivateAddr, got %v", err)
+	}
+
+	results, err := r.LookupBatch(context.Background(), []string{"brendan.abolivier.bzh"}, A)
+	if err != nil || len(results) != 1 || results[0].Err != ErrPrivateAddr {
+		t.Errorf("LookupBatch: unexpected results %v, %v", results, err)
+	}
+}
+
+func TestLookupBestEffort(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(
+			q,
+			buildRR(A, 300, []byte{51, 38, 47}),
+			buildRR(A, 300, []byte{51, 38, 47, 191}),
+		)
+	})
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrCorrupted {
+		t.Fail()
+	}
+
+	r.BestEffort = true
+	recs, ttls, err := r.LookupA("brendan.abolivier.bzh")
+	if _, ok := err.(AnswerErrors); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA || len(ttls) != 1 {
+		t.Fail()
+	}
+}
+
+func TestLookupBestEffortAdditional(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		// A SRV record in the additional section, which RDATA is too short
+		// to hold its priority, weight and port.
+		binary.BigEndian.PutUint16(res[10:12], 1)
+		return append(res, buildRR(SRV, 300, []byte{0, 10, 0})...)
+	})
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != ErrCorrupted {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	r.BestEffort = true
+	recs, ttls, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA || len(ttls) != 1 {
+		t.Fail()
+	}
+}
+
+func TestLookupUnparsedAnswer(t *testing.T) {
+	// An A record of the CH class, which this package doesn't parse.
+	rr := buildRR(A, 300, []byte{51, 38, 47, 191})
+	binary.BigEndian.PutUint16(rr[4:6], uint16(CH))
+
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, rr, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+
+	// The answer that couldn't be parsed must be skipped rather than make the
+	// lookup panic.
+	recs, ttls, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA || len(ttls) != 1 {
+		t.Fail()
+	}
+
+	// RDATA too short to hold the preference of a MX record.
+	r = newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(MX, 300, []byte{0}))
+	})
+
+	if _, _, err := r.LookupMX("abolivier.bzh"); err != ErrCorrupted {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLookupRaw(t *testing.T) {
+	// An answer with an invalid RDLENGTH, which can't be parsed.
+	var served []byte
+	r := newStubResolver(func(q []byte) []byte {
+		served = buildResponse(q, buildRR(A, 300, []byte{51, 38, 47}))
+		return served
+	})
+
+	res, err := r.LookupRaw(context.Background(), "brendan.abolivier.bzh", A, IN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if served == nil || !bytes.Equal(res, served) {
+		t.Fail()
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	r := newStubResolver(nil)
+	// Simulate a server that never replies.
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+	r.QueryTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	// The context doesn't have any deadline, so only the query timeout can
+	// abort the lookup.
+	_, _, err := r.LookupACtx(context.Background(), "brendan.abolivier.bzh")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded error, got %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fail()
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	r := newStubResolver(nil)
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		// Never respond, unless the request is canceled.
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+	r.DefaultTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, _, err := r.LookupA("brendan.abolivier.bzh")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took %s", elapsed)
+	}
+}
+
+func TestLookupAValidated(t *testing.T) {
+	for _, ad := range []bool{true, false} {
+		r := newStubResolver(func(q []byte) []byte {
+			// Check CD = 0 and AD = 1
+			if q[3]>>4 != 2 {
+				t.Errorf("unexpected AD and CD bits in query: %08b", q[3])
+			}
+
+			res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+			if !ad {
+				res[3] &^= 1 << 5
+			}
+			return res
+		})
+
+		recs, _, authenticated, err := r.LookupAValidated(context.Background(), "brendan.abolivier.bzh")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(recs) != 1 || authenticated != ad {
+			t.Fail()
+		}
+	}
+}
+
+func TestRequireAuthenticatedData(t *testing.T) {
+	for _, ad := range []bool{true, false} {
+		r := newStubResolver(func(q []byte) []byte {
+			// Check the query holds an OPT record with DO = 1.
+			if binary.BigEndian.Uint16(q[10:12]) != 1 || q[len(q)-4]&0x80 == 0 {
+				t.Errorf("the query doesn't have the DO bit set: %v", q)
+			}
+
+			// Check the query asks for validation, with AD = 1 and CD = 0.
+			if q[3]&(1<<5) == 0 || q[3]&(1<<4) != 0 {
+				t.Errorf("the query doesn't ask for validation: %v", q)
+			}
+
+			// Answer without the query's OPT record.
+			question := make([]byte, len(q)-11)
+			copy(question, q)
+			binary.BigEndian.PutUint16(question[10:12], 0)
+
+			res := buildResponse(question, buildRR(A, 300, []byte{51, 38, 47, 191}))
+			// The response is built from the query, which has AD = 1.
+			res[3] &^= 1 << 5
+			if ad {
+				res[3] |= 1 << 5
+			}
+			return res
+		})
+		r.RequireAuthenticatedData = true
+
+		recs, _, err := r.LookupA("brendan.abolivier.bzh")
+		if ad && (err != nil || len(recs) != 1 || recs[0].IP4 != expectedA) {
+			t.Errorf("unexpected result %v, %v", recs, err)
+		}
+
+		if !ad && (err != ErrNotAuthenticated || len(recs) != 0) {
+			t.Errorf("unexpected result %v, %v", recs, err)
+		}
+	}
+}
+
+func TestLookupNormalizeNames(t *testing.T) {
+	target := []byte("\x04Blog\x07Brendan\x09Abolivier\x03BZH\x00")
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(CNAME, 300, target))
+	})
+
+	// Names are returned as they're sent by default.
+	recs, _, err := r.LookupCNAME("Brendan.Abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].CNAME != "Blog.Brendan.Abolivier.BZH" || recs[0].Owner != "Brendan.Abolivier.bzh" {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+
+	r.NormalizeNames = true
+	recs, _, err = r.LookupCNAME("Brendan.Abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].CNAME != "blog.brendan.abolivier.bzh." || recs[0].Owner != "brendan.abolivier.bzh." {
+		t.Errorf("unexpected records %+v", recs)
+	}
+}
+
+func TestReportNoData(t *testing.T) {
+	soa, err := base64.RawStdEncoding.DecodeString(rdataSOA)
+	if err != nil {
+		t.FailNow()
+	}
+
+	r := newStubResolver(func(q []byte) []byte {
+		return withAuthority(buildResponse(q), buildRR(SOA, 3600, soa))
+	})
+
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil || len(recs) != 0 {
+		t.Fail()
+	}
+
+	r.ReportNoData = true
+	_, _, err = r.LookupA("brendan.abolivier.bzh")
+	if !errors.Is(err, ErrNoData) {
+		t.Fatalf("expected ErrNoData, got %v", err)
+	}
+
+	var noData *NoDataError
+	if !errors.As(err, &noData) {
+		t.FailNow()
+	}
+
+	if noData.SOA == nil || noData.SOA.PrimaryNS != expectedSOAPrimaryNS {
+		t.Fail()
+	}
+
+	// The SOA's MINIMUM is lower than its TTL.
+	if noData.TTL != expectedSOAMinimum {
+		t.Fail()
+	}
+}
+
+func TestReportNoDataCNAME(t *testing.T) {
+	target := bytes.NewBuffer(nil)
+	writeName(target, "blog.brendan.abolivier.bzh")
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(CNAME, 300, target.Bytes()))
+	})
+
+	// The response has an answer, but not of the type that was looked up.
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil || len(recs) != 0 {
+		t.Fail()
+	}
+
+	r.ReportNoData = true
+	if _, _, err = r.LookupA("brendan.abolivier.bzh"); !errors.Is(err, ErrNoData) {
+		t.Errorf("expected ErrNoData, got %v", err)
+	}
+
+	// The CNAME record is the answer to a CNAME lookup.
+	if recs, _, err := r.LookupCNAME("brendan.abolivier.bzh"); err != nil || len(recs) != 1 {
+		t.Errorf("unexpected result %v, %v", recs, err)
+	}
+}
+
+func TestReportNoDataCached(t *testing.T) {
+	target := bytes.NewBuffer(nil)
+	writeName(target, "blog.brendan.abolivier.bzh")
+	var queries int
+	r := newStubResolver(func(q []byte) []byte {
+		queries++
+		return buildResponse(q, buildRR(CNAME, 300, target.Bytes()))
+	})
+	r.Cache = NewCache(0)
+	r.ReportNoData = true
+
+	// The response is reported the same way when it's answered from the
+	// cache.
+	for i := 0; i < 2; i++ {
+		var noData *NoDataError
+		if _, _, err := r.LookupA("brendan.abolivier.bzh"); !errors.As(err, &noData) {
+			t.Errorf("lookup %d: expected a *NoDataError, got %v", i, err)
+		}
+	}
+
+	if queries != 1 {
+		t.Errorf("expected 1 query, got %d", queries)
+	}
+}
+
+func TestReportNoDataWithoutSOA(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q)
+	})
+	r.ReportNoData = true
+
+	_, _, err := r.LookupA("brendan.abolivier.bzh")
+	var noData *NoDataError
+	if !errors.As(err, &noData) || noData.SOA != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestLookupTLSAService(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataTLSA)
+	if err != nil {
+		t.FailNow()
+	}
+
+	expectedQuery := mustEncodeQuery("_443._tcp.brendan.abolivier.bzh", TLSA, IN, queryOptions{})
+	r := newStubResolver(func(q []byte) []byte {
+		if !bytes.Equal(q[2:], expectedQuery[2:]) {
+			t.Errorf("unexpected query %v", q)
+		}
+		return buildResponse(q, buildRR(TLSA, 300, rdata))
+	})
+
+	recs, _, err := r.LookupTLSAService(443, "tcp", "brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].Usage != expectedTLSAUsage {
+		t.Fail()
+	}
+}
+
+func TestLookupHooks(t *testing.T) {
+	var queries, responses []string
+	var errs []error
+	fail := false
+	r := newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		if fail {
+			res[3] |= 2
+		}
+		return res
+	})
+	r.OnQuery = func(fqdn string, rtype DNSType) {
+		queries = append(queries, fqdn+" "+rtype.String())
+	}
+	r.OnResponse = func(fqdn string, rtype DNSType, latency time.Duration, err error) {
+		if latency <= 0 {
+			t.Errorf("unexpected latency %s", latency)
+		}
+		responses = append(responses, fqdn+" "+rtype.String())
+		errs = append(errs, err)
+	}
+
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err != nil {
+		t.Fatal(err)
+	}
+
+	fail = true
+	if _, _, err := r.LookupAAAA("abolivier.bzh"); !errors.Is(err, ErrServerFailure) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []string{"brendan.abolivier.bzh A", "abolivier.bzh AAAA"}
+	if !reflect.DeepEqual(queries, expected) || !reflect.DeepEqual(responses, expected) {
+		t.Errorf("unexpected hook calls %v and %v", queries, responses)
+	}
+
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], ErrServerFailure) {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestLookupARotateAnswers(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q,
+			buildRR(A, 100, []byte{192, 0, 2, 1}),
+			buildRR(A, 200, []byte{192, 0, 2, 2}),
+			buildRR(A, 300, []byte{192, 0, 2, 3}),
+		)
+	})
+
+	check := func(expected []byte) {
+		t.Helper()
+
+		recs, ttls, err := r.LookupA("brendan.abolivier.bzh")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(recs) != len(expected) || len(ttls) != len(expected) {
+			t.Fatalf("unexpected records %v", recs)
+		}
+
+		for i, last := range expected {
+			// The TTLs must stay in lockstep with the records.
+			if recs[i].IP4 != net.IPv4(192, 0, 2, last).String() || ttls[i] != uint32(last)*100 {
+				t.Errorf("unexpected record %d: %s (TTL %d)", i, recs[i].IP4, ttls[i])
+			}
+		}
+	}
+
+	// Records are in the wire order by default.
+	check([]byte{1, 2, 3})
+	check([]byte{1, 2, 3})
+
+	r.RotateAnswers = true
+	check([]byte{1, 2, 3})
+	check([]byte{2, 3, 1})
+	check([]byte{3, 1, 2})
+	check([]byte{1, 2, 3})
+}
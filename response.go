@@ -2,6 +2,7 @@ package doh
 
 import (
 	"encoding/binary"
+	"strings"
 )
 
 // answer describes a parsed answer from the response message.
@@ -10,17 +11,132 @@ type answer struct {
 	t      DNSType
 	class  DNSClass
 	ttl    uint32
-	parsed interface{}
+	parsed Record
+}
+
+// setRRHeader fills the RRHeader of the parsed record, if it has one, with the
+// answer's owner name and TTL.
+func (a *answer) setRRHeader() {
+	if a.parsed == nil {
+		return
+	}
+
+	if h := a.parsed.rrHeader(); h != nil {
+		h.Owner = a.name
+		h.TTL = a.ttl
+	}
+}
+
+// question describes a question from the question section of a message.
+type question struct {
+	name  string
+	t     DNSType
+	class DNSClass
+}
+
+// message describes a parsed response message.
+type message struct {
+	header     Header
+	questions  []question
+	answers    []answer
+	authority  []answer
+	additional []answer
+}
+
+// hasQuestions returns whether the message has one question for each of the
+// given types, in the same order, which are all for the given name (ignoring
+// case) and class.
+func (m *message) hasQuestions(name string, types []DNSType, c DNSClass) bool {
+	if len(m.questions) != len(types) {
+		return false
+	}
+
+	for i, q := range m.questions {
+		if !strings.EqualFold(q.name, name) || q.t != types[i] || q.class != c {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasAnswer returns whether the message has an answer of one of the given
+// types. Otherwise, a successful response is a NODATA one, as described in
+// section 2.2 of RFC 2308, even if it holds e.g. CNAME records.
+func (m *message) hasAnswer(types []DNSType) bool {
+	for _, a := range m.answers {
+		for _, t := range types {
+			if a.t == t {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// opt returns the OPT record from the additional section of the message, or nil
+// if there isn't one.
+func (m *message) opt() *OPTRecord {
+	for _, a := range m.additional {
+		if opt, ok := a.parsed.(*OPTRecord); ok {
+			return opt
+		}
+	}
+
+	return nil
+}
+
+// parseOptions holds the settings used to parse a response. Its zero value
+// parses the response strictly, without checking it against any query.
+type parseOptions struct {
+	// bestEffort, when true, makes parsing carry on past answers which
+	// couldn't be parsed.
+	bestEffort bool
+	// checkID, when true, makes parsing fail with ErrIDMismatch if the ID of
+	// the response isn't id.
+	checkID bool
+	id      uint16
+	// checkQuestion, when true, makes parsing fail with ErrQuestionMismatch if
+	// the response's question isn't for qname (ignoring case), qtype and
+	// qclass, followed by a question for the same name and class for each of
+	// moreQTypes.
+	checkQuestion bool
+	qname         string
+	qtype         DNSType
+	qclass        DNSClass
+	moreQTypes    []DNSType
+	// checkCase, when true, makes parsing fail with ErrCaseMismatch if the
+	// response's question isn't for qname with the exact same case, which is
+	// how 0x20 encoding detects forged responses.
+	checkCase bool
+	// normalizeNames, when true, makes parsing return the names from records
+	// lowercased and with a trailing dot.
+	normalizeNames bool
 }
 
 // parseResponse parses the message the resolver responded with.
-// Returns all of the answers included in the message.
+// Returns the parsed message, which includes the records of all of its
+// sections.
 // Returns an error if the message isn't a response, if the message includes
 // header values that are not currently supported, or if the message includes an
-// error code.
-func parseResponse(res []byte) ([]answer, error) {
+// error code (in which case the message is returned along with the error if it
+// could be parsed, and the error is a *NXDomainError for name errors if so),
+// ErrIDMismatch if opts.checkID is true and the ID of the response isn't
+// opts.id, ErrQuestionMismatch if opts.checkQuestion is true and the
+// response's question isn't the one described in opts, or ErrCaseMismatch if
+// opts.checkCase is true and the response's question isn't for opts.qname with
+// the same case. The question isn't checked if the response has an error code
+// and no question.
+// If opts.bestEffort is false, parsing stops at the first answer which couldn't
+// be parsed, and ErrCorrupted is returned, as it is if there are bytes left
+// after the last record the header declares. Otherwise, the message is returned
+// with the answers which could be parsed, along with an AnswerErrors
+// describing the others.
+func parseResponse(res []byte, opts parseOptions) (*message, error) {
 	p := new(parser)
 	p.res = res
+	p.normalizeNames = opts.normalizeNames
 
 	if len(res) < DNSMsgHeaderLen {
 		return nil, ErrCorrupted
@@ -46,6 +162,11 @@ func parseResponse(res []byte) ([]answer, error) {
 		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 	*/
 
+	// Check the ID matches the query's
+	if opts.checkID && binary.BigEndian.Uint16(res[0:2]) != opts.id {
+		return nil, ErrIDMismatch
+	}
+
 	// Check QR == 1 (is response)
 	qr := res[2] >> 7
 	if qr != 1 {
@@ -66,14 +187,77 @@ func parseResponse(res []byte) ([]answer, error) {
 		return nil, ErrTruncated
 	}
 
-	// Check RCODE == 0 (no error)
-	rcode := res[3] & 15
+	rcode := int(res[3] & 15)
+
+	msg := new(message)
+	msg.header = Header{
+		Authoritative:      res[2]>>2&1 == 1,
+		RecursionDesired:   res[2]&1 == 1,
+		RecursionAvailable: res[3]>>7 == 1,
+		AuthenticatedData:  res[3]>>5&1 == 1,
+	}
+
+	// Check RCODE == 0 (no error). The rest of the message is parsed anyway,
+	// since it can still hold useful records, e.g. the SOA of the zone in the
+	// authority section of a NXDOMAIN response, or the OPT record holding the
+	// upper bits of the response code.
+	errs, err := p.parseSections(msg, opts.bestEffort)
+	if err != nil {
+		// If the message couldn't be parsed, the error code is still more
+		// relevant than the parsing error.
+		if rcode != 0 {
+			return nil, &RCodeError{Code: rcode}
+		}
+		return nil, err
+	}
+
+	// Combine the RCODE with the extended RCODE of the OPT record, if any, as
+	// described in section 6.1.3 of RFC 6891.
+	if opt := msg.opt(); opt != nil {
+		rcode |= int(opt.ExtendedRCode) << 4
+	}
+	msg.header.RCode = rcode
+
+	// Servers often respond to queries they reject (e.g. with FORMERR,
+	// REFUSED or NOTIMP) without echoing the question, in which case the
+	// response code is what matters.
+	if rcode == 0 || len(msg.questions) > 0 {
+		if opts.checkQuestion && !msg.hasQuestions(opts.qname, append([]DNSType{opts.qtype}, opts.moreQTypes...), opts.qclass) {
+			return nil, ErrQuestionMismatch
+		}
+
+		if opts.checkCase && (len(msg.questions) == 0 || msg.questions[0].name != opts.qname) {
+			return nil, ErrCaseMismatch
+		}
+	}
+
+	if rcode == rcodeNameError {
+		return msg, newNXDomainError(msg)
+	}
 	if rcode != 0 {
-		return nil, dnsErrors[rcode]
+		return msg, &RCodeError{Code: rcode}
+	}
+
+	if len(errs) > 0 {
+		return msg, errs
 	}
 
+	return msg, nil
+}
+
+// parseSections parses the question, answer, authority and additional sections
+// of the response into the given message.
+// If bestEffort is false, parsing stops at the first record which couldn't be
+// parsed, and ErrCorrupted is returned, as it is if there are bytes left after
+// the last record. Otherwise, the records which could be parsed are added to
+// the message, and errors describing the answers which couldn't are returned.
+func (p *parser) parseSections(msg *message, bestEffort bool) (errs AnswerErrors, err error) {
+	res := p.res
+
 	qdcount := binary.BigEndian.Uint16(res[4:6])
 	ancount := binary.BigEndian.Uint16(res[6:8])
+	nscount := binary.BigEndian.Uint16(res[8:10])
+	arcount := binary.BigEndian.Uint16(res[10:12])
 
 	// Get to the very first byte after decoding headers.
 	buf := res[DNSMsgHeaderLen:]
@@ -81,7 +265,6 @@ func parseResponse(res []byte) ([]answer, error) {
 	for i = 0; i < qdcount; i++ {
 		/*
 			Parse queries
-			We only process them in order to reach the answers section.
 
 			                               1  1  1  1  1  1
 			 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
@@ -95,72 +278,151 @@ func parseResponse(res []byte) ([]answer, error) {
 			|                     QCLASS                    |
 			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 		*/
-		if len(buf) == 0 {
+		name, offset, err := p.parseName(buf)
+		if err != nil || len(buf) < offset+4 {
 			return nil, ErrCorrupted
 		}
-		_, offset := p.parseName(buf)
+		msg.questions = append(msg.questions, question{
+			name:  name,
+			t:     DNSType(binary.BigEndian.Uint16(buf[offset : offset+2])),
+			class: DNSClass(binary.BigEndian.Uint16(buf[offset+2 : offset+4])),
+		})
 		buf = buf[offset+4:]
 	}
 
 	// Now buf should be at the first byte of the first answer.
-	answers := make([]answer, 0)
-	for i = 0; i < ancount; i++ {
-		/*
-			Parse answers
+	msg.answers, buf, errs, err = p.parseRRs(buf, ancount, bestEffort)
+	if err != nil {
+		return nil, err
+	}
 
-			                               1  1  1  1  1  1
-			 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-			|                                               |
-			/                                               /
-			/                      NAME                     /
-			|                                               |
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-			|                      TYPE                     |
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-			|                     CLASS                     |
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-			|                      TTL                      |
-			|                                               |
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-			|                   RDLENGTH                    |
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--|
-			/                     RDATA                     /
-			/                                               /
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	// Then parse the authority and additional sections. In best-effort mode,
+	// answers are the only records we report errors for.
+	msg.authority, buf, _, err = p.parseRRs(buf, nscount, bestEffort)
+	if err != nil {
+		return nil, err
+	}
 
-			NAME (or some labels) can be compressed as:
+	msg.additional, buf, _, err = p.parseRRs(buf, arcount, bestEffort)
+	if err != nil {
+		return nil, err
+	}
 
-			                               1  1  1  1  1  1
-			 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-			| 1  1|                OFFSET                   |
-			+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
-		*/
+	// A well-formed response ends with its last record. Leftover bytes mean
+	// the counts in the header don't match the records, or that a malformed
+	// record threw the parser off.
+	if !bestEffort && len(buf) > 0 {
+		return nil, ErrCorrupted
+	}
 
-		if len(buf) == 0 {
-			return nil, ErrCorrupted
+	return errs, nil
+}
+
+// parseRRs parses count resource records from the start of the given buffer.
+// Returns the records, as well as the rest of the buffer after them.
+// If bestEffort is false, parsing stops at the first record which couldn't be
+// parsed, and ErrCorrupted is returned. Otherwise, the records which could be
+// parsed are returned along with errors describing the others. If a record is
+// incomplete, the rest of the buffer is returned as nil, since there's no way
+// to locate the next records.
+func (p *parser) parseRRs(buf []byte, count uint16, bestEffort bool) (rrs []answer, rest []byte, errs AnswerErrors, err error) {
+	rrs = make([]answer, 0)
+	var i uint16
+	for i = 0; i < count; i++ {
+		a, rdata, offset, err := p.splitRR(buf)
+		if err != nil {
+			if !bestEffort {
+				return nil, nil, nil, err
+			}
+			// There's no way to locate the next records if this one is
+			// incomplete.
+			errs = append(errs, &AnswerError{Index: int(i), Err: err})
+			return rrs, nil, errs, nil
 		}
-		name, offset := p.parseName(buf)
-		t := DNSType(binary.BigEndian.Uint16(buf[offset : offset+2]))
-		class := DNSClass(binary.BigEndian.Uint16(buf[offset+2 : offset+4]))
-		ttl := binary.BigEndian.Uint32(buf[offset+4 : offset+8])
-		rdlength := binary.BigEndian.Uint16(buf[offset+8 : offset+10])
-		rdata := buf[offset+10 : offset+10+int(rdlength)]
 
 		// Set buffer value for next occurrence.
-		buf = buf[offset+10+int(rdlength):]
-
-		// Parse the answer.
-		parsed := p.parse(t, class, rdata)
-		answers = append(answers, answer{
-			name:   name,
-			t:      t,
-			class:  class,
-			ttl:    ttl,
-			parsed: parsed,
-		})
+		buf = buf[offset:]
+
+		// Parse the record. OPT records need their CLASS and TTL, which
+		// don't have their usual meaning.
+		if a.t == OPT {
+			a.parsed, err = parseOPT(a.class, a.ttl, rdata)
+		} else {
+			a.parsed, err = p.parse(a.t, a.class, rdata)
+		}
+		if err != nil {
+			if !bestEffort {
+				return nil, nil, nil, err
+			}
+			errs = append(errs, &AnswerError{Index: int(i), Err: err})
+			continue
+		}
+
+		a.setRRHeader()
+		rrs = append(rrs, a)
 	}
 
-	return answers, nil
+	return rrs, buf, errs, nil
+}
+
+// splitRR reads the resource record at the start of the given buffer, without
+// parsing its RDATA.
+// Returns the record, its RDATA, and the number of bytes the record takes in
+// the buffer.
+// Returns ErrCorrupted if the record is incomplete.
+func (p *parser) splitRR(buf []byte) (a answer, rdata []byte, offset int, err error) {
+	/*
+		RESOURCE RECORD
+
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                                               |
+		/                                               /
+		/                      NAME                     /
+		|                                               |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                      TYPE                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                     CLASS                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                      TTL                      |
+		|                                               |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                   RDLENGTH                    |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--|
+		/                     RDATA                     /
+		/                                               /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+
+		NAME (or some labels) can be compressed as:
+
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		| 1  1|                OFFSET                   |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+
+	a.name, offset, err = p.parseRecordName(buf)
+	if err != nil || len(buf) < offset+10 {
+		err = ErrCorrupted
+		return
+	}
+
+	a.t = DNSType(binary.BigEndian.Uint16(buf[offset : offset+2]))
+	a.class = DNSClass(binary.BigEndian.Uint16(buf[offset+2 : offset+4]))
+	a.ttl = binary.BigEndian.Uint32(buf[offset+4 : offset+8])
+	rdlength := int(binary.BigEndian.Uint16(buf[offset+8 : offset+10]))
+	offset += 10
+
+	if len(buf) < offset+rdlength {
+		err = ErrCorrupted
+		return
+	}
+
+	rdata = buf[offset : offset+rdlength]
+	offset += rdlength
+
+	return
 }
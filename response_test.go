@@ -1,7 +1,10 @@
 package doh
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"testing"
 )
 
@@ -50,7 +53,7 @@ func TestValidHeaders(t *testing.T) {
 	}
 
 	// parseResponse only returns an error if something in the header isn't right.
-	if _, err = parseResponse(res); err != nil {
+	if _, err = parseResponse(res, parseOptions{}); err != nil {
 		t.Fail()
 	}
 }
@@ -62,21 +65,51 @@ func TestValidAnswers(t *testing.T) {
 	}
 
 	// errors are checked in the test above, so we ignore them for now
-	answers, _ := parseResponse(res)
+	msg, _ := parseResponse(res, parseOptions{})
 
-	if len(answers) != validAnswersCount {
+	if len(msg.answers) != validAnswersCount {
 		t.Fail()
 	}
 
-	if c := countAnswers(CNAME, answers); c != validCNAMECount {
+	if c := countAnswers(CNAME, msg.answers); c != validCNAMECount {
 		t.Fail()
 	}
 
-	if c := countAnswers(A, answers); c != validACount {
+	if c := countAnswers(A, msg.answers); c != validACount {
 		t.Fail()
 	}
 }
 
+func TestValidAnswersOwner(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(validResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	msg, err := parseResponse(res, parseOptions{})
+	if err != nil || len(msg.answers) != validAnswersCount {
+		t.FailNow()
+	}
+
+	// Each record of the CNAME chain belongs to the target of the previous
+	// one.
+	expected := []string{
+		"brendan.abolivier.bzh",
+		"blog.brendan.abolivier.bzh",
+		"blog.brendanabolivier.com",
+		"aragog.brendanabolivier.com",
+	}
+	for i, a := range msg.answers[:validCNAMECount] {
+		if owner := a.parsed.(*CNAMERecord).Owner; owner != expected[i] {
+			t.Errorf("unexpected owner %s for answer %d", owner, i)
+		}
+	}
+
+	if owner := msg.answers[validCNAMECount].parsed.(*ARecord).Owner; owner != expected[validCNAMECount] {
+		t.Errorf("unexpected owner %s for the A answer", owner)
+	}
+}
+
 func countAnswers(t DNSType, answers []answer) (c int) {
 	for _, a := range answers {
 		if a.t == t {
@@ -94,7 +127,7 @@ func TestNotAResponse(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrNotAResponse {
+	if _, err = parseResponse(res, parseOptions{}); err == nil || err != ErrNotAResponse {
 		t.Fail()
 	}
 }
@@ -105,7 +138,7 @@ func TestNotStandardQuery(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrNotStandardQuery {
+	if _, err = parseResponse(res, parseOptions{}); err == nil || err != ErrNotStandardQuery {
 		t.Fail()
 	}
 }
@@ -116,7 +149,7 @@ func TestTruncated(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrTruncated {
+	if _, err = parseResponse(res, parseOptions{}); err == nil || err != ErrTruncated {
 		t.Fail()
 	}
 }
@@ -127,7 +160,7 @@ func TestFormatError(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrFormatError {
+	if _, err = parseResponse(res, parseOptions{}); !errors.Is(err, ErrFormatError) {
 		t.Fail()
 	}
 }
@@ -138,7 +171,7 @@ func TestServerFailure(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrServerFailure {
+	if _, err = parseResponse(res, parseOptions{}); !errors.Is(err, ErrServerFailure) {
 		t.Fail()
 	}
 }
@@ -149,7 +182,7 @@ func TestNameError(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrNameError {
+	if _, err = parseResponse(res, parseOptions{}); !errors.Is(err, ErrNameError) {
 		t.Fail()
 	}
 }
@@ -160,7 +193,7 @@ func TestNotImplemented(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrNotImplemented {
+	if _, err = parseResponse(res, parseOptions{}); !errors.Is(err, ErrNotImplemented) {
 		t.Fail()
 	}
 }
@@ -171,13 +204,13 @@ func TestRefused(t *testing.T) {
 		t.FailNow()
 	}
 
-	if _, err = parseResponse(res); err == nil || err != ErrRefused {
+	if _, err = parseResponse(res, parseOptions{}); !errors.Is(err, ErrRefused) {
 		t.Fail()
 	}
 }
 
 func TestEmpty(t *testing.T) {
-	if _, err := parseResponse([]byte(empty)); err == nil || err != ErrCorrupted {
+	if _, err := parseResponse([]byte(empty), parseOptions{}); err == nil || err != ErrCorrupted {
 		t.Fail()
 	}
 }
@@ -187,7 +220,269 @@ func TestCorrupted(t *testing.T) {
 	if err != nil {
 		t.FailNow()
 	}
-	if _, err := parseResponse(res); err == nil || err != ErrCorrupted {
+	if _, err := parseResponse(res, parseOptions{}); err == nil || err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestInvalidPointer(t *testing.T) {
+	rr := buildRR(A, 300, []byte{51, 38, 47, 191})
+	// Point past the end of the message.
+	rr[0], rr[1] = 0xff, 0xff
+	res := buildResponse(mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{}), rr)
+
+	if _, err := parseResponse(res, parseOptions{}); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestPointerLoop(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+	rr := buildRR(A, 300, []byte{51, 38, 47, 191})
+	// Point at the pointer itself.
+	binary.BigEndian.PutUint16(rr[0:2], 0xc000|uint16(len(q)))
+	res := buildResponse(q, rr)
+
+	if _, err := parseResponse(res, parseOptions{}); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+func TestUnknownRCode(t *testing.T) {
+	res := buildResponse(mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{}))
+	// RCODE = 9 (not authoritative)
+	res[3] |= 9
+
+	_, err := parseResponse(res, parseOptions{})
+	var rcodeErr *RCodeError
+	if !errors.As(err, &rcodeErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if rcodeErr.Code != 9 || rcodeErr.Name() != "NOTAUTH" || errors.Unwrap(err) != nil {
+		t.Fail()
+	}
+
+	for _, sentinel := range dnsErrors[1:] {
+		if errors.Is(err, sentinel) {
+			t.Fail()
+		}
+	}
+}
+
+func TestNameErrorAuthority(t *testing.T) {
+	soa, err := base64.RawStdEncoding.DecodeString(rdataSOA)
+	if err != nil {
+		t.FailNow()
+	}
+
+	res := withAuthority(
+		buildResponse(mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})),
+		buildRR(SOA, 3600, soa),
+	)
+	// RCODE = 3 (name error)
+	res[3] |= 3
+
+	msg, err := parseResponse(res, parseOptions{})
+	if !errors.Is(err, ErrNameError) || msg == nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(msg.authority) != 1 || msg.authority[0].t != SOA {
+		t.FailNow()
+	}
+
+	if msg.authority[0].parsed.(*SOARecord).PrimaryNS != expectedSOAPrimaryNS {
+		t.Fail()
+	}
+}
+
+// NXDOMAIN response for nonexistent.abolivier.bzh, with the SOA record of
+// abolivier.bzh (TTL 1800, MINIMUM 300) in its authority section.
+const nxdomainResponse = "KjGBgwABAAAAAQAAC25vbmV4aXN0ZW50CWFib2xpdmllcgNiemgAAAEAAcAYAAYAAQAABwgANQZkbnMyMDAHYW55Y2FzdAJtZQAEdGVjaANvdmgDbmV0AHhXz6AAAVGAAAAOEAA27oAAAAEs"
+
+func TestNXDomainError(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(nxdomainResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	_, err = parseResponse(res, parseOptions{})
+	var nxErr *NXDomainError
+	if !errors.As(err, &nxErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if nxErr.SOA == nil || nxErr.SOA.PrimaryNS != expectedSOAPrimaryNS {
+		t.FailNow()
+	}
+
+	if nxErr.TTL != expectedSOAMinimum {
+		t.Errorf("unexpected negative TTL %d", nxErr.TTL)
+	}
+
+	// The error must still match the sentinel and the response code.
+	var rcodeErr *RCodeError
+	if !errors.Is(err, ErrNameError) || !errors.As(err, &rcodeErr) || rcodeErr.Code != 3 {
+		t.Fail()
+	}
+
+	// Without a SOA record, the error only carries the response code. The
+	// record is removed along with its count, since the response would
+	// otherwise have leftover bytes.
+	binary.BigEndian.PutUint16(res[8:10], 0)
+	_, err = parseResponse(res[:DNSMsgHeaderLen+len("nonexistent.abolivier.bzh")+2+4], parseOptions{})
+	if !errors.As(err, &nxErr) || nxErr.SOA != nil || nxErr.TTL != 0 {
+		t.Fail()
+	}
+}
+
+func TestTrailingBytes(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+	res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}), buildRR(A, 300, []byte{51, 38, 47, 192}))
+	// Declare a single answer while the response holds two.
+	binary.BigEndian.PutUint16(res[6:8], 1)
+
+	if _, err := parseResponse(res, parseOptions{}); err != ErrCorrupted {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Best-effort parsing carries on with the declared answers.
+	msg, err := parseResponse(res, parseOptions{bestEffort: true})
+	if err != nil || len(msg.answers) != 1 {
+		t.Fail()
+	}
+}
+
+func TestTruncatedResponses(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(validResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	// Cut the response at every byte, which covers each fixed-size read of
+	// the header, the question and the records.
+	for n := 0; n < len(res); n++ {
+		if _, err := parseResponse(res[:n], parseOptions{}); err != ErrCorrupted {
+			t.Errorf("unexpected error %v for a response cut at %d bytes", err, n)
+		}
+
+		// Best-effort parsing mustn't panic either.
+		parseResponse(res[:n], parseOptions{bestEffort: true})
+	}
+
+	// A response claiming many more records than it holds.
+	for _, i := range []int{4, 6, 8, 10} {
+		huge := make([]byte, len(res))
+		copy(huge, res)
+		binary.BigEndian.PutUint16(huge[i:i+2], 0xffff)
+		if _, err := parseResponse(huge, parseOptions{}); err != ErrCorrupted {
+			t.Errorf("unexpected error %v for a count of 65535 at offset %d", err, i)
+		}
+	}
+}
+
+func TestAdditional(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(validResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	msg, err := parseResponse(res, parseOptions{})
+	if err != nil {
+		t.FailNow()
+	}
+
+	// The additional section only holds an OPT record.
+	if len(msg.additional) != 1 || msg.additional[0].t != OPT {
+		t.Fail()
+	}
+}
+
+func TestParseOPT(t *testing.T) {
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	res := buildResponse(mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{}))
+	opt := bytes.NewBuffer(nil)
+	writeOPT(opt, 1452, true, []ednsOption{{code: 10, data: cookie}})
+	binary.BigEndian.PutUint16(res[10:12], 1)
+	res = append(res, opt.Bytes()...)
+
+	msg, err := parseResponse(res, parseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := msg.opt()
+	if rec == nil || rec.UDPSize != 1452 || rec.ExtendedRCode != 0 || rec.Version != 0 || !rec.DNSSECOK {
+		t.Fatalf("unexpected OPT record %+v", rec)
+	}
+
+	if len(rec.Options) != 1 || rec.Options[0].Code != 10 || !bytes.Equal(rec.Options[0].Data, cookie) {
+		t.Errorf("unexpected options %+v", rec.Options)
+	}
+
+	// EXTENDED-RCODE = 1, which combined with RCODE = 0 is 16 (BADVERS).
+	res[len(res)-len(opt.Bytes())+5] = 1
+	msg, err = parseResponse(res, parseOptions{})
+	var rcodeErr *RCodeError
+	if !errors.As(err, &rcodeErr) || msg == nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if rcodeErr.Code != 16 || rcodeErr.Name() != "BADVERS" || msg.header.RCode != 16 {
+		t.Fail()
+	}
+
+	// An option overflowing the RDATA makes the record invalid.
+	res[len(res)-len(cookie)-1] = 9
+	if _, err = parseResponse(res, parseOptions{}); err != ErrCorrupted {
+		t.Fail()
+	}
+}
+
+// Testing best-effort parsing.
+
+func TestBestEffort(t *testing.T) {
+	res := buildResponse(
+		mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{}),
+		buildRR(A, 300, []byte{51, 38, 47, 191}),
+		// RDLENGTH of 3 is invalid for an A record.
+		buildRR(A, 300, []byte{51, 38, 47}),
+		buildRR(A, 300, []byte{51, 38, 47, 192}),
+	)
+
+	if _, err := parseResponse(res, parseOptions{}); err != ErrCorrupted {
+		t.Fail()
+	}
+
+	msg, err := parseResponse(res, parseOptions{bestEffort: true})
+	if len(msg.answers) != 2 {
 		t.Fail()
 	}
+
+	errs, ok := err.(AnswerErrors)
+	if !ok || len(errs) != 1 || errs[0].Index != 1 || errs[0].Err != ErrCorrupted {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestBestEffortIncomplete(t *testing.T) {
+	res := buildResponse(
+		mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{}),
+		buildRR(A, 300, []byte{51, 38, 47, 191}),
+		buildRR(A, 300, []byte{51, 38, 47, 192}),
+	)
+	// Cut the last answer's RDATA short, so it overruns the message.
+	res = res[:len(res)-2]
+
+	msg, err := parseResponse(res, parseOptions{bestEffort: true})
+	if len(msg.answers) != 1 {
+		t.Fail()
+	}
+
+	errs, ok := err.(AnswerErrors)
+	if !ok || len(errs) != 1 || errs[0].Index != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
 }
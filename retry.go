@@ -0,0 +1,86 @@
+package doh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultRetryBackoff is the backoff used between retries of a query if the
+// resolver's RetryBackoff isn't set. It waits for 100ms before the first retry,
+// and doubles that time before each subsequent one.
+func DefaultRetryBackoff(retry int) time.Duration {
+	return 100 * time.Millisecond << uint(retry-1)
+}
+
+// maxRetryAfter is the longest time a resolver waits for before retrying a
+// query, even if the server asks for a longer delay in a Retry-After header.
+const maxRetryAfter = 30 * time.Second
+
+// exchangeRetry is the same as exchange, but sends the query again after
+// failing with a transient error, at most r.MaxRetries times, waiting between
+// attempts according to r.RetryBackoff, or for as long as the server asked in
+// a Retry-After header (up to maxRetryAfter).
+// Returns the last error without waiting if the context's deadline would be
+// reached before a retry, or the context's error if it's done while waiting
+// for a retry.
+func (r *Resolver) exchangeRetry(ctx context.Context, fqdn string, t DNSType, c DNSClass, opts queryOptions) (*message, error) {
+	backoff := r.RetryBackoff
+	if backoff == nil {
+		backoff = DefaultRetryBackoff
+	}
+
+	msg, err := r.exchange(ctx, fqdn, t, c, opts)
+	for retry := 1; retry <= r.MaxRetries && r.isRetryable(ctx, err); retry++ {
+		wait := backoff(retry)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+			wait = httpErr.RetryAfter
+			if wait > maxRetryAfter {
+				wait = maxRetryAfter
+			}
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return msg, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+
+		msg, err = r.exchange(ctx, fqdn, t, c, opts)
+	}
+
+	return msg, err
+}
+
+// isRetryable returns whether a query which failed with the given error can be
+// sent again, i.e. if the error is transient and the given context isn't done.
+func (r *Resolver) isRetryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	if r.RetryServerFailure && errors.Is(err, ErrServerFailure) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
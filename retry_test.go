@@ -0,0 +1,235 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newFlakyResolver returns a resolver which HTTP client fails the first
+// failures requests with the given status code, and answers the next ones
+// using answer. The number of requests sent is reported in calls.
+func newFlakyResolver(failures, status int, calls *int, answer func(q []byte) []byte) *Resolver {
+	transport := func(req *http.Request) (*http.Response, error) {
+		*calls++
+		q, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if *calls <= failures {
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+				Request:    req,
+			}, nil
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/dns-message"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(answer(q))),
+			Request:    req,
+		}, nil
+	}
+
+	return &Resolver{
+		Host:         "doh.example.com",
+		Class:        IN,
+		HTTPClient:   &http.Client{Transport: roundTripperFunc(transport)},
+		MaxRetries:   3,
+		RetryBackoff: func(int) time.Duration { return time.Millisecond },
+	}
+}
+
+func TestLookupRetry(t *testing.T) {
+	calls := 0
+	r := newFlakyResolver(2, http.StatusServiceUnavailable, &calls, func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA || calls != 3 {
+		t.Fail()
+	}
+}
+
+func TestLookupRetryExhausted(t *testing.T) {
+	calls := 0
+	r := newFlakyResolver(10, http.StatusBadGateway, &calls, nil)
+
+	_, _, err := r.LookupA("brendan.abolivier.bzh")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadGateway {
+		t.Fail()
+	}
+
+	// The first attempt followed by 3 retries.
+	if calls != 4 {
+		t.Errorf("unexpected number of requests %d", calls)
+	}
+}
+
+func TestLookupNoRetry(t *testing.T) {
+	// Client errors aren't transient.
+	calls := 0
+	r := newFlakyResolver(1, http.StatusBadRequest, &calls, nil)
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); err == nil || calls != 1 {
+		t.Fail()
+	}
+
+	// Neither are name errors.
+	calls = 0
+	r = newFlakyResolver(0, 0, &calls, func(q []byte) []byte {
+		res := buildResponse(q)
+		res[3] |= 3
+		return res
+	})
+	if _, _, err := r.LookupA("brendan.abolivier.bzh"); !errors.Is(err, ErrNameError) || calls != 1 {
+		t.Fail()
+	}
+}
+
+func TestLookupRetryServerFailure(t *testing.T) {
+	for _, retry := range []bool{false, true} {
+		calls := 0
+		r := newFlakyResolver(0, 0, &calls, func(q []byte) []byte {
+			if calls == 1 {
+				res := buildResponse(q)
+				res[3] |= 2
+				return res
+			}
+			return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+		})
+		r.RetryServerFailure = retry
+
+		_, _, err := r.LookupA("brendan.abolivier.bzh")
+		if retry && (err != nil || calls != 2) {
+			t.Errorf("unexpected error %v after %d requests", err, calls)
+		}
+		if !retry && (!errors.Is(err, ErrServerFailure) || calls != 1) {
+			t.Errorf("unexpected error %v after %d requests", err, calls)
+		}
+	}
+}
+
+func TestLookupRetryCanceled(t *testing.T) {
+	calls := 0
+	r := newFlakyResolver(10, http.StatusServiceUnavailable, &calls, nil)
+	r.RetryBackoff = func(int) time.Duration { return time.Hour }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, _, err := r.LookupACtx(ctx, "brendan.abolivier.bzh")
+	if err != context.Canceled || calls != 1 {
+		t.Fail()
+	}
+}
+
+func TestLookupRetryDeadline(t *testing.T) {
+	calls := 0
+	r := newFlakyResolver(10, http.StatusServiceUnavailable, &calls, nil)
+	r.RetryBackoff = func(int) time.Duration { return time.Hour }
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Waiting for the backoff would exceed the deadline, so the lookup must
+	// fail right away.
+	_, _, err := r.LookupACtx(ctx, "brendan.abolivier.bzh")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || calls != 1 {
+		t.Fail()
+	}
+}
+
+func TestLookupRetryAfter(t *testing.T) {
+	calls := 0
+	r := newFlakyResolver(1, http.StatusTooManyRequests, &calls, func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+
+	transport := r.HTTPClient.Transport
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := transport.RoundTrip(req)
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+			resp.Header = http.Header{"Retry-After": []string{"1"}}
+		}
+		return resp, err
+	})
+
+	start := time.Now()
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || calls != 2 {
+		t.Fail()
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s", elapsed)
+	}
+}
+
+func TestLookupRetryQueryTimeout(t *testing.T) {
+	var calls int
+	r := newFlakyResolver(0, 0, &calls, func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+	})
+	r.MaxRetries = 1
+	r.RetryBackoff = func(int) time.Duration { return 0 }
+	r.QueryTimeout = 50 * time.Millisecond
+
+	// The first attempt never gets a response.
+	transport := r.HTTPClient.Transport
+	r.HTTPClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if calls == 0 {
+			calls++
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return transport.RoundTrip(req)
+	})
+
+	// The context leaves enough time for a retry after the first attempt
+	// times out.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	recs, _, err := r.LookupACtx(ctx, "brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || calls != 2 {
+		t.Errorf("unexpected records %v after %d calls", recs, calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"Wed, 01 Jan 2020 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 Jan 2020 11:00:00 GMT": 0,
+		"-1":                            0,
+		"soon":                          0,
+	}
+
+	for value, expected := range tests {
+		if d := parseRetryAfter(value, now); d != expected {
+			t.Errorf("%s: expected %s, got %s", value, expected, d)
+		}
+	}
+}
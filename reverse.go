@@ -0,0 +1,85 @@
+package doh
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// hexDigits is used to write the nibbles of IPv6 addresses.
+const hexDigits = "0123456789abcdef"
+
+// reverseName builds the name to look up PTR records on in order to perform a
+// reverse lookup of the given IP address, i.e. a name in the in-addr.arpa
+// domain (as described in section 3.5 of RFC 1035) for IPv4 addresses, or in
+// the ip6.arpa domain (as described in section 2.5 of RFC 3596) for IPv6
+// addresses.
+// Returns ErrInvalidAddr if the IP address is invalid.
+func reverseName(ip net.IP) (string, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		labels := make([]string, 0, net.IPv4len+2)
+		for i := net.IPv4len - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ip4[i])))
+		}
+		labels = append(labels, "in-addr", "arpa")
+		return strings.Join(labels, "."), nil
+	}
+
+	if len(ip) != net.IPv6len {
+		return "", ErrInvalidAddr
+	}
+
+	labels := make([]string, 0, 2*net.IPv6len+2)
+	for i := net.IPv6len - 1; i >= 0; i-- {
+		labels = append(labels, string(hexDigits[ip[i]&0xf]), string(hexDigits[ip[i]>>4]))
+	}
+	labels = append(labels, "ip6", "arpa")
+	return strings.Join(labels, "."), nil
+}
+
+// LookupHostname performs a reverse DoH lookup of the given IP address, bounded
+// by the given context, and returns the first name the address maps to,
+// without any trailing dot.
+// Returns ErrInvalidAddr if the IP address is invalid, or ErrNoData if the
+// address doesn't map to any name, or an error if something went wrong at the
+// network level, or when parsing the response headers.
+func (r *Resolver) LookupHostname(ctx context.Context, ip net.IP) (string, error) {
+	name, err := reverseName(ip)
+	if err != nil {
+		return "", err
+	}
+
+	recs, _, err := r.LookupPTRCtx(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(recs) == 0 {
+		return "", ErrNoData
+	}
+
+	return strings.TrimSuffix(recs[0].PTR, "."), nil
+}
+
+// LookupAddr performs a reverse DoH lookup on PTR records for the given IP
+// address, bounded by the given context. The address must be in a format
+// net.ParseIP understands.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on.
+// Returns ErrInvalidAddr if the address can't be parsed, or an error if
+// something went wrong at the network level, or when parsing the response
+// headers.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) (recs []*PTRRecord, ttls []uint32, err error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		err = ErrInvalidAddr
+		return
+	}
+
+	name, err := reverseName(ip)
+	if err != nil {
+		return
+	}
+
+	return r.LookupPTRCtx(ctx, name)
+}
@@ -0,0 +1,104 @@
+package doh
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	names := map[string]string{
+		"51.38.47.191":               "191.47.38.51.in-addr.arpa",
+		"::ffff:51.38.47.191":        "191.47.38.51.in-addr.arpa",
+		"2001:41d0:302:1100::a:d8f1": "1.f.8.d.a.0.0.0.0.0.0.0.0.0.0.0.0.0.1.1.2.0.3.0.0.d.1.4.1.0.0.2.ip6.arpa",
+	}
+
+	for ip, expected := range names {
+		name, err := reverseName(net.ParseIP(ip))
+		if err != nil || name != expected {
+			t.Errorf("unexpected reverse name %q for %s", name, ip)
+		}
+	}
+
+	if _, err := reverseName(net.IP{1, 2, 3}); err != ErrInvalidAddr {
+		t.Fail()
+	}
+}
+
+func TestLookupHostname(t *testing.T) {
+	ptr, err := base64.RawStdEncoding.DecodeString(rdataPTR)
+	if err != nil {
+		t.FailNow()
+	}
+
+	other, err := base64.RawStdEncoding.DecodeString(rdataCNAME)
+	if err != nil {
+		t.FailNow()
+	}
+
+	responses := map[string][][]byte{
+		expectedPTR: {buildRR(PTR, 300, ptr)},
+		// With several records, the first one wins.
+		expectedCNAME: {buildRR(PTR, 300, other), buildRR(PTR, 300, ptr)},
+		"":            nil,
+	}
+
+	for expected, rrs := range responses {
+		rrs := rrs
+		r := newStubResolver(func(q []byte) []byte {
+			return buildResponse(q, rrs...)
+		})
+
+		name, err := r.LookupHostname(context.Background(), net.ParseIP(expectedA))
+		if len(expected) == 0 {
+			if err != ErrNoData {
+				t.Errorf("expected ErrNoData, got %v", err)
+			}
+			continue
+		}
+
+		if err != nil || name != expected {
+			t.Errorf("expected %q, got %q (%v)", expected, name, err)
+		}
+	}
+}
+
+func TestLookupAddr(t *testing.T) {
+	ptr, err := base64.RawStdEncoding.DecodeString(rdataPTR)
+	if err != nil {
+		t.FailNow()
+	}
+
+	names := map[string]string{
+		"51.38.47.191":               "191.47.38.51.in-addr.arpa",
+		"2001:41d0:302:1100::a:d8f1": "1.f.8.d.a.0.0.0.0.0.0.0.0.0.0.0.0.0.1.1.2.0.3.0.0.d.1.4.1.0.0.2.ip6.arpa",
+	}
+
+	for addr, expected := range names {
+		var name string
+		r := newStubResolver(func(q []byte) []byte {
+			p := &parser{res: q}
+			name, _, _ = p.parseName(q[DNSMsgHeaderLen:])
+			return buildResponse(q, buildRR(PTR, 300, ptr))
+		})
+
+		recs, _, err := r.LookupAddr(context.Background(), addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name != expected {
+			t.Errorf("unexpected reverse name %q for %s", name, addr)
+		}
+
+		if len(recs) != 1 || recs[0].PTR != expectedPTR {
+			t.Fail()
+		}
+	}
+
+	r := newStubResolver(nil)
+	if _, _, err := r.LookupAddr(context.Background(), "not an address"); err != ErrInvalidAddr {
+		t.Fail()
+	}
+}
@@ -0,0 +1,129 @@
+package doh
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// LookupSRVSorted performs a DoH lookup on SRV records for the given service,
+// network and domain, bounded by the given context, in the same way as
+// LookupServiceCtx, and returns the records in the order their targets should
+// be tried in, as described in RFC 2782: by ascending priority, and randomly
+// weighted by their weight among records with the same priority.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers, or ErrNoService if the domain explicitly
+// states that the service isn't available, with a single record which target
+// is ".".
+func (r *Resolver) LookupSRVSorted(ctx context.Context, service, network, domain string) ([]*SRVRecord, error) {
+	recs, _, err := r.LookupServiceCtx(ctx, service, network, domain)
+	if recs == nil {
+		return nil, err
+	}
+
+	if len(recs) == 1 && (recs[0].Target == "" || recs[0].Target == ".") {
+		return nil, ErrNoService
+	}
+
+	return sortSRV(recs), err
+}
+
+// LookupServiceAddrs performs a DoH lookup on SRV records for the given
+// service, network and domain, bounded by the given context, then on the
+// addresses of their targets (see LookupIP), and returns the host:port
+// addresses to try to connect to the service at, in order: the addresses of
+// each target are in the order LookupSRVSorted returns the targets in.
+// Targets which addresses can't be looked up are skipped.
+// Returns an empty slice and no error if the domain explicitly states that the
+// service isn't available, with a single record which target is ".".
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers, or the error from looking up the addresses of
+// the last target if no address could be found for any of them.
+func (r *Resolver) LookupServiceAddrs(ctx context.Context, service, network, domain string) ([]string, error) {
+	recs, err := r.LookupSRVSorted(ctx, service, network, domain)
+	if err == ErrNoService {
+		return []string{}, nil
+	}
+	if recs == nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(recs))
+	var ipErr error
+	for _, rec := range recs {
+		ips, _, err := r.LookupIP(ctx, rec.Target)
+		if err != nil {
+			ipErr = err
+			continue
+		}
+
+		port := strconv.Itoa(int(rec.Port))
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+		}
+	}
+
+	if len(addrs) == 0 && ipErr != nil {
+		return nil, ipErr
+	}
+
+	return addrs, err
+}
+
+// sortSRV returns the given SRV records sorted by ascending priority, and by a
+// random selection weighted by their weight among records of the same
+// priority, as described in the "Usage rules" of RFC 2782.
+func sortSRV(recs []*SRVRecord) []*SRVRecord {
+	sorted := make([]*SRVRecord, len(recs))
+	copy(sorted, recs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+
+		shuffleByWeight(sorted[start:end])
+		start = end
+	}
+
+	return sorted
+}
+
+// shuffleByWeight reorders the given SRV records, which all have the same
+// priority, by repeatedly selecting one of the records left at random, with a
+// probability proportional to its weight.
+func shuffleByWeight(recs []*SRVRecord) {
+	// Records with a weight of 0 are placed first, so they have a small
+	// chance of being selected, instead of none.
+	sort.SliceStable(recs, func(i, j int) bool {
+		return recs[i].Weight == 0 && recs[j].Weight != 0
+	})
+
+	sum := 0
+	for _, rec := range recs {
+		sum += int(rec.Weight)
+	}
+
+	for i := range recs {
+		n := rand.Intn(sum + 1)
+		running := 0
+		for j := i; j < len(recs); j++ {
+			running += int(recs[j].Weight)
+			if running >= n {
+				sum -= int(recs[j].Weight)
+				// Keep the records left in the same order, so records with a
+				// weight of 0 stay first.
+				selected := recs[j]
+				copy(recs[i+1:j+1], recs[i:j])
+				recs[i] = selected
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package doh
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// buildSRV returns the RDATA of a SRV record with the given priority, weight
+// and target, on port 443.
+func buildSRV(priority, weight uint16, target string) []byte {
+	rdata := bytes.NewBuffer(nil)
+	binary.Write(rdata, binary.BigEndian, []uint16{priority, weight, 443})
+	writeName(rdata, target)
+	return rdata.Bytes()
+}
+
+func TestLookupSRVSorted(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(
+			q,
+			buildRR(SRV, 300, buildSRV(20, 10, "backup.abolivier.bzh")),
+			buildRR(SRV, 300, buildSRV(10, 0, "zero.abolivier.bzh")),
+			buildRR(SRV, 300, buildSRV(10, 60, "big.abolivier.bzh")),
+			buildRR(SRV, 300, buildSRV(10, 40, "small.abolivier.bzh")),
+		)
+	})
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		recs, err := r.LookupSRVSorted(context.Background(), "matrix", "tcp", "abolivier.bzh")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(recs) != 4 {
+			t.Fatalf("expected 4 records, got %d", len(recs))
+		}
+
+		// The record with the highest priority value always comes last.
+		for _, rec := range recs[:3] {
+			if rec.Priority != 10 {
+				t.Fatalf("unexpected order %v", recs)
+			}
+		}
+		if recs[3].Target != "backup.abolivier.bzh" {
+			t.Fatalf("unexpected order %v", recs)
+		}
+
+		seen[recs[0].Target] = true
+	}
+
+	// Both records with a non-zero weight get selected first at some point.
+	if !seen["big.abolivier.bzh"] || !seen["small.abolivier.bzh"] {
+		t.Errorf("unexpected first records %v", seen)
+	}
+}
+
+func TestLookupSRVSortedNoService(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(SRV, 300, buildSRV(0, 0, ".")))
+	})
+
+	recs, err := r.LookupSRVSorted(context.Background(), "matrix", "tcp", "abolivier.bzh")
+	if err != ErrNoService || recs != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLookupServiceAddrs(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		name, offset, err := (&parser{res: q}).parseName(q[DNSMsgHeaderLen:])
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+
+		switch DNSType(binary.BigEndian.Uint16(q[DNSMsgHeaderLen+offset:])) {
+		case SRV:
+			return buildResponse(
+				q,
+				buildRR(SRV, 300, buildSRV(20, 0, "backup.abolivier.bzh")),
+				buildRR(SRV, 300, buildSRV(10, 0, "main.abolivier.bzh")),
+				buildRR(SRV, 300, buildSRV(30, 0, "unknown.abolivier.bzh")),
+			)
+		case A:
+			switch name {
+			case "main.abolivier.bzh":
+				return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+			case "backup.abolivier.bzh":
+				return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 192}))
+			}
+		case AAAA:
+			if name == "main.abolivier.bzh" {
+				return buildResponse(q, buildRR(AAAA, 300, net.ParseIP("2001:db8::1")))
+			}
+		}
+
+		return buildResponse(q)
+	})
+
+	addrs, err := r.LookupServiceAddrs(context.Background(), "matrix", "tcp", "abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"[2001:db8::1]:443", "51.38.47.191:443", "51.38.47.192:443"}
+	if !reflect.DeepEqual(addrs, expected) {
+		t.Errorf("unexpected addresses %v", addrs)
+	}
+}
+
+func TestLookupServiceAddrsNoService(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(SRV, 300, buildSRV(0, 0, ".")))
+	})
+
+	addrs, err := r.LookupServiceAddrs(context.Background(), "matrix", "tcp", "abolivier.bzh")
+	if err != nil || addrs == nil || len(addrs) != 0 {
+		t.Errorf("unexpected result %v, %v", addrs, err)
+	}
+}
@@ -0,0 +1,132 @@
+package doh
+
+import (
+	"context"
+)
+
+// Header describes the flags and response code from the header of a response,
+// as described in section 4.1.1 of RFC 1035 and section 3.2 of RFC 4035.
+// It has no TC bit, since lookups never return truncated responses.
+type Header struct {
+	// Authoritative is the value of the AA bit, i.e. whether the server is an
+	// authority for the name that was looked up.
+	Authoritative bool
+	// RecursionDesired is the value of the RD bit, i.e. whether the query
+	// asked for recursion.
+	RecursionDesired bool
+	// RecursionAvailable is the value of the RA bit, i.e. whether the server
+	// supports recursive queries.
+	RecursionAvailable bool
+	// AuthenticatedData is the value of the AD bit, i.e. whether the server
+	// considers the answers as authentic.
+	AuthenticatedData bool
+	// RCode is the response code, e.g. 3 for NXDOMAIN.
+	RCode int
+}
+
+// Answer describes a record from one of the sections of a response.
+type Answer struct {
+	Name  string
+	Type  DNSType
+	Class DNSClass
+	TTL   uint32
+	// Record is the parsed record, or nil if its type isn't supported by this
+	// package.
+	Record Record
+}
+
+// Response describes a response to a DoH lookup.
+type Response struct {
+	// Header holds the flags and response code from the header of the
+	// response.
+	Header Header
+	// Answers holds the records from the answer section of the response, in
+	// the order the server sent them in.
+	Answers []Answer
+	// Authority holds the records from the authority section of the
+	// response, e.g. the SOA record of the zone for a NXDOMAIN response.
+	Authority []Answer
+	// Additional holds the records from the additional section of the
+	// response.
+	Additional []Answer
+	// Wildcard is whether the answers look synthesized from a wildcard (e.g.
+	// *.example.com), which can only be detected if the response includes
+	// the RRSIG records of the answers, e.g. with the resolver's DNSSECOK set.
+	// Synthesized answers are still returned under the name that was looked
+	// up.
+	Wildcard bool
+}
+
+// LookupResponse performs a DoH lookup on records of the given type for the
+// given FQDN, bounded by the given context, and returns every answer from the
+// response regardless of its type, e.g. the CNAME records that led to the
+// requested records.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers. The response is returned along with the error
+// if the server responded with an error code, e.g. so that the SOA record of a
+// NXDOMAIN response can be read from its authority section, or in best-effort
+// mode if the error is an AnswerErrors.
+func (r *Resolver) LookupResponse(ctx context.Context, fqdn string, t DNSType) (*Response, error) {
+	msg, err := r.lookup(ctx, fqdn, t, r.class())
+	if err != nil && msg == nil {
+		return nil, err
+	}
+
+	res := &Response{
+		Header:     msg.header,
+		Answers:    exportAnswers(msg.answers),
+		Authority:  exportAnswers(msg.authority),
+		Additional: exportAnswers(msg.additional),
+		Wildcard:   msg.wildcard(),
+	}
+
+	return res, err
+}
+
+// LookupWithHeader performs a DoH lookup on records of the given type for the
+// given FQDN, bounded by the given context, the same way Lookup does.
+// Returns records and TTLs such that ttls[0] is the TTL for recs[0], and so on,
+// as well as the header of the response, e.g. for diagnostic purposes.
+// Returns an error if something went wrong at the network level, or when
+// parsing the response headers. The header is returned along with the error if
+// the response could be parsed, e.g. if it includes an error code.
+func (r *Resolver) LookupWithHeader(ctx context.Context, fqdn string, t DNSType) (recs []Record, ttls []uint32, hdr *Header, err error) {
+	recs, ttls, msg, err := r.lookupRecords(ctx, fqdn, t, r.class(), queryOptions{})
+	if msg != nil {
+		hdr = new(Header)
+		*hdr = msg.header
+	}
+
+	return
+}
+
+// exportAnswers converts the given records to their exported form.
+func exportAnswers(answers []answer) []Answer {
+	exported := make([]Answer, 0, len(answers))
+	for _, a := range answers {
+		exported = append(exported, Answer{
+			Name:   a.name,
+			Type:   a.t,
+			Class:  a.class,
+			TTL:    a.ttl,
+			Record: a.parsed,
+		})
+	}
+
+	return exported
+}
+
+// ByType groups the records of the response's answers by type, preserving
+// the order they appear in within each group. Answers which type isn't
+// supported by this package aren't included.
+func (res *Response) ByType() map[DNSType][]Record {
+	byType := make(map[DNSType][]Record)
+	for _, a := range res.Answers {
+		if a.Record == nil {
+			continue
+		}
+		byType[a.Type] = append(byType[a.Type], a.Record)
+	}
+
+	return byType
+}
@@ -0,0 +1,118 @@
+package doh
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestLookupResponseByType(t *testing.T) {
+	res, err := base64.RawStdEncoding.DecodeString(validResponse)
+	if err != nil {
+		t.FailNow()
+	}
+
+	r := newStubResolver(func(q []byte) []byte {
+		// Answer with the query's ID.
+		copy(res[0:2], q[0:2])
+		return res
+	})
+
+	resp, err := r.LookupResponse(context.Background(), "brendan.abolivier.bzh", A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Answers) != validAnswersCount {
+		t.Fail()
+	}
+
+	byType := resp.ByType()
+	if len(byType) != 2 ||
+		len(byType[CNAME]) != validCNAMECount ||
+		len(byType[A]) != validACount {
+		t.FailNow()
+	}
+
+	if byType[CNAME][0].(*CNAMERecord).CNAME != "blog.brendan.abolivier.bzh" {
+		t.Fail()
+	}
+
+	if byType[A][0].(*ARecord).IP4 != expectedA {
+		t.Fail()
+	}
+}
+
+func TestLookupResponseNameError(t *testing.T) {
+	soa, err := base64.RawStdEncoding.DecodeString(rdataSOA)
+	if err != nil {
+		t.FailNow()
+	}
+
+	r := newStubResolver(func(q []byte) []byte {
+		res := withAuthority(buildResponse(q), buildRR(SOA, 3600, soa))
+		// RCODE = 3 (name error)
+		res[3] |= 3
+		return res
+	})
+
+	resp, err := r.LookupResponse(context.Background(), "brendan.abolivier.bzh", A)
+	if !errors.Is(err, ErrNameError) || resp == nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if len(resp.Answers) != 0 || len(resp.Authority) != 1 {
+		t.FailNow()
+	}
+
+	if resp.Authority[0].Record.(*SOARecord).PrimaryNS != expectedSOAPrimaryNS {
+		t.Fail()
+	}
+}
+
+func TestLookupWithHeader(t *testing.T) {
+	for _, aa := range []bool{false, true} {
+		r := newStubResolver(func(q []byte) []byte {
+			res := buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}))
+			if aa {
+				res[2] |= 1 << 2
+			} else {
+				// RA = 0
+				res[3] &^= 1 << 7
+			}
+			return res
+		})
+
+		recs, _, hdr, err := r.LookupWithHeader(context.Background(), "brendan.abolivier.bzh", A)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(recs) != 1 || hdr == nil {
+			t.FailNow()
+		}
+
+		if hdr.Authoritative != aa || hdr.RecursionAvailable != aa || !hdr.RecursionDesired {
+			t.Errorf("unexpected header %+v", hdr)
+		}
+
+		if hdr.AuthenticatedData || hdr.RCode != 0 {
+			t.Errorf("unexpected header %+v", hdr)
+		}
+	}
+}
+
+func TestLookupWithHeaderNameError(t *testing.T) {
+	r := newStubResolver(func(q []byte) []byte {
+		res := buildResponse(q)
+		// RCODE = 3 (name error)
+		res[3] |= 3
+		return res
+	})
+
+	_, _, hdr, err := r.LookupWithHeader(context.Background(), "brendan.abolivier.bzh", A)
+	if !errors.Is(err, ErrNameError) || hdr == nil || hdr.RCode != 3 {
+		t.Fail()
+	}
+}
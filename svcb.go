@@ -0,0 +1,59 @@
+package doh
+
+import (
+	"encoding/binary"
+)
+
+// SvcParam keys, as listed in section 14.3.2 of RFC 9460.
+const (
+	// SVCBKeyMandatory is the key of the mandatory SvcParam.
+	SVCBKeyMandatory = 0
+	// SVCBKeyALPN is the key of the alpn SvcParam.
+	SVCBKeyALPN = 1
+	// SVCBKeyNoDefaultALPN is the key of the no-default-alpn SvcParam.
+	SVCBKeyNoDefaultALPN = 2
+	// SVCBKeyPort is the key of the port SvcParam.
+	SVCBKeyPort = 3
+	// SVCBKeyIPv4Hint is the key of the ipv4hint SvcParam.
+	SVCBKeyIPv4Hint = 4
+	// SVCBKeyECH is the key of the ech SvcParam.
+	SVCBKeyECH = 5
+	// SVCBKeyIPv6Hint is the key of the ipv6hint SvcParam.
+	SVCBKeyIPv6Hint = 6
+)
+
+// ALPN returns the protocol identifiers of the record's alpn SvcParam, as
+// described in section 7.1.1 of RFC 9460.
+// Returns false if the record doesn't include the parameter, or if its value
+// is malformed.
+func (s *SVCBRecord) ALPN() (protocols []string, ok bool) {
+	value, ok := s.Params[SVCBKeyALPN]
+	if !ok || len(value) == 0 {
+		return nil, false
+	}
+
+	for len(value) > 0 {
+		protocol, offset, err := readCharacterString(value)
+		if err != nil || len(protocol) == 0 {
+			return nil, false
+		}
+
+		protocols = append(protocols, protocol)
+		value = value[offset:]
+	}
+
+	return protocols, true
+}
+
+// Port returns the value of the record's port SvcParam, as described in
+// section 7.2 of RFC 9460.
+// Returns false if the record doesn't include the parameter, or if its value
+// is malformed.
+func (s *SVCBRecord) Port() (port uint16, ok bool) {
+	value, ok := s.Params[SVCBKeyPort]
+	if !ok || len(value) != 2 {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint16(value), true
+}
@@ -0,0 +1,63 @@
+package doh
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestSVCBALPN(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataHTTPS)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseSVCB(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	alpn, ok := rec.ALPN()
+	if !ok || !reflect.DeepEqual(alpn, []string{"h3", "h2"}) {
+		t.Fail()
+	}
+
+	// The record doesn't include any port.
+	if _, ok := rec.Port(); ok {
+		t.Fail()
+	}
+}
+
+func TestSVCBPort(t *testing.T) {
+	rdata, err := base64.RawStdEncoding.DecodeString(rdataSVCB)
+	if err != nil {
+		t.FailNow()
+	}
+
+	p := new(parser)
+	rec, err := p.parseSVCB(rdata)
+	if err != nil {
+		t.FailNow()
+	}
+
+	port, ok := rec.Port()
+	if !ok || port != expectedSVCBPort {
+		t.Fail()
+	}
+
+	alpn, ok := rec.ALPN()
+	if !ok || !reflect.DeepEqual(alpn, []string{"h2"}) {
+		t.Fail()
+	}
+}
+
+func TestSVCBParamsOrder(t *testing.T) {
+	// 1 . port=443 alpn=h2, with keys in the wrong order.
+	rdata := []byte{0, 1, 0, 0, 3, 0, 2, 1, 187, 0, 1, 0, 3, 2, 'h', '2'}
+
+	p := new(parser)
+	if _, err := p.parseSVCB(rdata); err != ErrCorrupted {
+		t.Fail()
+	}
+}
@@ -0,0 +1,101 @@
+package doh
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ConnInfo describes the connection a DoH request has been sent over, and the
+// time it took to establish it, e.g. to check that requests reuse their
+// connections instead of performing a new TLS handshake each time.
+type ConnInfo struct {
+	// Reused is whether the connection has previously been used for other
+	// requests.
+	Reused bool
+	// WasIdle is whether the connection was idle before being used for the
+	// request, in which case IdleTime is the time it was idle for.
+	WasIdle  bool
+	IdleTime time.Duration
+	// DNSDuration, ConnectDuration and TLSDuration are the time it took to
+	// resolve the host, to connect to it and to perform the TLS handshake.
+	// They're zero for the steps that didn't happen, e.g. for reused
+	// connections.
+	DNSDuration     time.Duration
+	ConnectDuration time.Duration
+	TLSDuration     time.Duration
+}
+
+// connTracer records the information about the connection of a request
+// reported by net/http/httptrace. Its callbacks can be called from several
+// goroutines.
+type connTracer struct {
+	mu   sync.Mutex
+	info ConnInfo
+
+	dnsStart, connectStart, tlsStart time.Time
+}
+
+// withConnTrace returns the given request with a trace recording the
+// information about the connection it's sent over, as well as a function to
+// call once the request has been sent, which reports it with r.OnConn.
+// Returns the request unchanged if r.OnConn isn't set.
+func (r *Resolver) withConnTrace(req *http.Request) (*http.Request, func()) {
+	if r.OnConn == nil {
+		return req, func() {}
+	}
+
+	ct := new(connTracer)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			ct.mu.Lock()
+			defer ct.mu.Unlock()
+			ct.info.Reused = info.Reused
+			ct.info.WasIdle = info.WasIdle
+			ct.info.IdleTime = info.IdleTime
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			ct.start(&ct.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			ct.done(ct.dnsStart, &ct.info.DNSDuration)
+		},
+		ConnectStart: func(_, _ string) {
+			ct.start(&ct.connectStart)
+		},
+		ConnectDone: func(_, _ string, _ error) {
+			ct.done(ct.connectStart, &ct.info.ConnectDuration)
+		},
+		TLSHandshakeStart: func() {
+			ct.start(&ct.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			ct.done(ct.tlsStart, &ct.info.TLSDuration)
+		},
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return req, func() {
+		ct.mu.Lock()
+		info := ct.info
+		ct.mu.Unlock()
+		r.OnConn(info)
+	}
+}
+
+// start records the start time of a step in the given field.
+func (ct *connTracer) start(t *time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	*t = time.Now()
+}
+
+// done records the duration of a step which started at the given time in the
+// given field.
+func (ct *connTracer) done(start time.Time, d *time.Duration) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	*d = time.Since(start)
+}
@@ -0,0 +1,354 @@
+package doh
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// typeTSIG is the DNS type of TSIG records.
+const typeTSIG DNSType = 250
+
+// TSIG algorithms, as listed in section 6 of RFC 8945.
+const (
+	// HMACSHA1 implements the hmac-sha1 TSIG algorithm.
+	HMACSHA1 = "hmac-sha1"
+	// HMACSHA256 implements the hmac-sha256 TSIG algorithm.
+	HMACSHA256 = "hmac-sha256"
+	// HMACSHA512 implements the hmac-sha512 TSIG algorithm.
+	HMACSHA512 = "hmac-sha512"
+)
+
+// TSIG error codes, as listed in section 3 of RFC 8945.
+const (
+	tsigBadSig  = 16
+	tsigBadKey  = 17
+	tsigBadTime = 18
+)
+
+// defaultTSIGFudge is the fudge used if none is configured, as recommended by
+// section 10 of RFC 8945.
+const defaultTSIGFudge = 300
+
+// tsigNow returns the time used to sign queries and check the time window of
+// responses. It is overridden in tests.
+var tsigNow = time.Now
+
+// TSIGConfig holds the settings used to sign queries and to verify the
+// signature of responses using TSIG, as described in RFC 8945.
+type TSIGConfig struct {
+	// The name of the key shared with the server.
+	KeyName string
+	// The HMAC algorithm to sign with, must be one of HMACSHA1, HMACSHA256 or
+	// HMACSHA512.
+	Algorithm string
+	// The secret shared with the server.
+	Secret []byte
+	// The number of seconds the time a message is signed at is allowed to
+	// differ from the current time. Defaults to 300 if zero.
+	Fudge uint16
+}
+
+// tsigRecord describes the content of a TSIG record.
+type tsigRecord struct {
+	name       string
+	algorithm  string
+	timeSigned uint64
+	fudge      uint16
+	mac        []byte
+	originalID uint16
+	err        uint16
+	other      []byte
+}
+
+// hash returns the hash function of the configured algorithm.
+func (c *TSIGConfig) hash() (func() hash.Hash, error) {
+	switch strings.ToLower(c.Algorithm) {
+	case HMACSHA1:
+		return sha1.New, nil
+	case HMACSHA256:
+		return sha256.New, nil
+	case HMACSHA512:
+		return sha512.New, nil
+	}
+
+	return nil, ErrTSIGAlgorithm
+}
+
+// sign signs the given query as described in section 5.1 of RFC 8945, i.e.
+// appends a TSIG record to its additional section.
+// Returns the signed query, as well as its MAC, which is needed to verify the
+// response.
+// Returns ErrTSIGAlgorithm if the configured algorithm isn't supported, or
+// ErrInvalidName if the key name isn't a valid domain name.
+func (c *TSIGConfig) sign(q []byte) (signed []byte, mac []byte, err error) {
+	h, err := c.hash()
+	if err != nil {
+		return
+	}
+
+	if err = checkName(c.KeyName); err != nil {
+		return
+	}
+
+	rec := &tsigRecord{
+		name:       c.KeyName,
+		algorithm:  c.Algorithm,
+		timeSigned: uint64(tsigNow().Unix()),
+		fudge:      c.Fudge,
+		originalID: binary.BigEndian.Uint16(q[0:2]),
+	}
+	if rec.fudge == 0 {
+		rec.fudge = defaultTSIGFudge
+	}
+
+	m := hmac.New(h, c.Secret)
+	m.Write(q)
+	m.Write(rec.variables())
+	rec.mac = m.Sum(nil)
+
+	b := bytes.NewBuffer(nil)
+	b.Write(q)
+	rec.write(b)
+	signed = b.Bytes()
+
+	// ARCOUNT += 1
+	arcount := binary.BigEndian.Uint16(signed[10:12])
+	binary.BigEndian.PutUint16(signed[10:12], arcount+1)
+
+	return signed, rec.mac, nil
+}
+
+// verify verifies the TSIG record of the given response as described in
+// section 5.3 of RFC 8945, given the MAC of the query it responds to.
+// Returns ErrTSIGUnsigned if the response isn't signed, ErrTSIGBadKey if it's
+// signed with another key or if the server doesn't know ours, ErrTSIGBadSig if
+// its MAC is invalid or if the server couldn't verify ours, ErrTSIGBadTime if
+// it's been signed outside of the allowed time window or if the server
+// considers the query has been, or ErrCorrupted if the response couldn't be
+// parsed.
+func (c *TSIGConfig) verify(res []byte, reqMAC []byte) error {
+	h, err := c.hash()
+	if err != nil {
+		return err
+	}
+
+	rec, start, err := findTSIG(res)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(rec.name, c.KeyName) ||
+		!strings.EqualFold(rec.algorithm, c.Algorithm) {
+		return ErrTSIGBadKey
+	}
+
+	switch rec.err {
+	case 0:
+	case tsigBadSig:
+		return ErrTSIGBadSig
+	case tsigBadKey:
+		return ErrTSIGBadKey
+	case tsigBadTime:
+		return ErrTSIGBadTime
+	default:
+		return fmt.Errorf("the server returned TSIG error %d", rec.err)
+	}
+
+	// Rebuild the response as it was before being signed, i.e. without its
+	// TSIG record, and with its original ID.
+	unsigned := make([]byte, start)
+	copy(unsigned, res[:start])
+	binary.BigEndian.PutUint16(unsigned[0:2], rec.originalID)
+	arcount := binary.BigEndian.Uint16(unsigned[10:12])
+	binary.BigEndian.PutUint16(unsigned[10:12], arcount-1)
+
+	macSize := []byte{0, 0}
+	binary.BigEndian.PutUint16(macSize, uint16(len(reqMAC)))
+
+	m := hmac.New(h, c.Secret)
+	m.Write(macSize)
+	m.Write(reqMAC)
+	m.Write(unsigned)
+	m.Write(rec.variables())
+	if !hmac.Equal(m.Sum(nil), rec.mac) {
+		return ErrTSIGBadSig
+	}
+
+	now := tsigNow().Unix()
+	if now < int64(rec.timeSigned)-int64(rec.fudge) || now > int64(rec.timeSigned)+int64(rec.fudge) {
+		return ErrTSIGBadTime
+	}
+
+	return nil
+}
+
+// variables returns the TSIG variables of the record, which are part of the
+// MAC's input, as described in section 4.3.3 of RFC 8945.
+func (t *tsigRecord) variables() []byte {
+	b := bytes.NewBuffer(nil)
+	writeName(b, strings.ToLower(t.name))
+	binary.Write(b, binary.BigEndian, uint16(ANYCLASS))
+	// TTL = 0
+	b.Write([]byte{0, 0, 0, 0})
+	writeName(b, strings.ToLower(t.algorithm))
+	t.writeTimers(b)
+	binary.Write(b, binary.BigEndian, t.err)
+	binary.Write(b, binary.BigEndian, uint16(len(t.other)))
+	b.Write(t.other)
+	return b.Bytes()
+}
+
+// write writes the record to the given buffer in wire format.
+func (t *tsigRecord) write(b *bytes.Buffer) {
+	/*
+		                               1  1  1  1  1  1
+		 0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                 ALGORITHM NAME                /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                                               |
+		|                  TIME SIGNED                  |
+		|                                               |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                     FUDGE                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                    MAC SIZE                   |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                      MAC                      /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                  ORIGINAL ID                  |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                     ERROR                     |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		|                   OTHER LEN                   |
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+		/                   OTHER DATA                  /
+		+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+	*/
+	rdata := bytes.NewBuffer(nil)
+	writeName(rdata, strings.ToLower(t.algorithm))
+	t.writeTimers(rdata)
+	binary.Write(rdata, binary.BigEndian, uint16(len(t.mac)))
+	rdata.Write(t.mac)
+	binary.Write(rdata, binary.BigEndian, t.originalID)
+	binary.Write(rdata, binary.BigEndian, t.err)
+	binary.Write(rdata, binary.BigEndian, uint16(len(t.other)))
+	rdata.Write(t.other)
+
+	writeName(b, strings.ToLower(t.name))
+	binary.Write(b, binary.BigEndian, uint16(typeTSIG))
+	binary.Write(b, binary.BigEndian, uint16(ANYCLASS))
+	// TTL = 0
+	b.Write([]byte{0, 0, 0, 0})
+	binary.Write(b, binary.BigEndian, uint16(rdata.Len()))
+	b.Write(rdata.Bytes())
+}
+
+// writeTimers writes the time signed (on 48 bits) and fudge of the record to the
+// given buffer.
+func (t *tsigRecord) writeTimers(b *bytes.Buffer) {
+	timeSigned := make([]byte, 8)
+	binary.BigEndian.PutUint64(timeSigned, t.timeSigned)
+	b.Write(timeSigned[2:])
+	binary.Write(b, binary.BigEndian, t.fudge)
+}
+
+// findTSIG looks for the TSIG record of the given message, which must be the
+// last record of its additional section.
+// Returns the record, along with the offset it starts at in the message.
+// Returns ErrTSIGUnsigned if the message doesn't end with a TSIG record, or
+// ErrCorrupted if the message couldn't be parsed.
+func findTSIG(res []byte) (rec *tsigRecord, start int, err error) {
+	if len(res) < DNSMsgHeaderLen {
+		return nil, 0, ErrCorrupted
+	}
+
+	p := new(parser)
+	p.res = res
+
+	qdcount := binary.BigEndian.Uint16(res[4:6])
+	rrcount := int(binary.BigEndian.Uint16(res[6:8])) +
+		int(binary.BigEndian.Uint16(res[8:10])) +
+		int(binary.BigEndian.Uint16(res[10:12]))
+	if binary.BigEndian.Uint16(res[10:12]) == 0 {
+		return nil, 0, ErrTSIGUnsigned
+	}
+
+	offset := DNSMsgHeaderLen
+	for i := 0; i < int(qdcount); i++ {
+		if offset >= len(res) {
+			return nil, 0, ErrCorrupted
+		}
+
+		_, n, err := p.parseName(res[offset:])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if offset+n+4 > len(res) {
+			return nil, 0, ErrCorrupted
+		}
+		offset += n + 4
+	}
+
+	var a answer
+	var rdata []byte
+	for i := 0; i < rrcount; i++ {
+		if offset > len(res) {
+			return nil, 0, ErrCorrupted
+		}
+
+		var n int
+		start = offset
+		a, rdata, n, err = p.splitRR(res[offset:])
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+	}
+
+	if a.t != typeTSIG {
+		return nil, 0, ErrTSIGUnsigned
+	}
+
+	rec = &tsigRecord{name: a.name}
+
+	var n int
+	rec.algorithm, n, err = p.parseName(rdata)
+	if err != nil {
+		return nil, 0, err
+	}
+	rdata = rdata[n:]
+	if len(rdata) < 10 {
+		return nil, 0, ErrCorrupted
+	}
+
+	rec.timeSigned = uint64(binary.BigEndian.Uint16(rdata[0:2]))<<32 |
+		uint64(binary.BigEndian.Uint32(rdata[2:6]))
+	rec.fudge = binary.BigEndian.Uint16(rdata[6:8])
+	macSize := int(binary.BigEndian.Uint16(rdata[8:10]))
+	rdata = rdata[10:]
+	if len(rdata) < macSize+6 {
+		return nil, 0, ErrCorrupted
+	}
+
+	rec.mac = rdata[:macSize]
+	rdata = rdata[macSize:]
+	rec.originalID = binary.BigEndian.Uint16(rdata[0:2])
+	rec.err = binary.BigEndian.Uint16(rdata[2:4])
+	otherLen := int(binary.BigEndian.Uint16(rdata[4:6]))
+	if len(rdata) < otherLen+6 {
+		return nil, 0, ErrCorrupted
+	}
+	rec.other = rdata[6 : 6+otherLen]
+
+	return rec, start, nil
+}
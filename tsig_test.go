@@ -0,0 +1,202 @@
+package doh
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+const (
+	tsigTestKeyName = "testkey.example"
+	tsigTestSecret  = "secret-tsig-key-for-tests"
+	tsigTestTime    = 1600000000
+	// MAC of the query for brendan.abolivier.bzh with ID 0x1234, signed with
+	// the test key at tsigTestTime, computed independently.
+	expectedTSIGMAC = "75e8c17f5598dbfb4bd52968a33b9d4959fe30bd48802c62be1c578a51ba17fa"
+)
+
+func newTestTSIGConfig() *TSIGConfig {
+	return &TSIGConfig{
+		KeyName:   tsigTestKeyName,
+		Algorithm: HMACSHA256,
+		Secret:    []byte(tsigTestSecret),
+	}
+}
+
+// setTSIGNow makes TSIG operations use the given time until the returned
+// function is called.
+func setTSIGNow(now int64) func() {
+	tsigNow = func() time.Time { return time.Unix(now, 0) }
+	return func() { tsigNow = time.Now }
+}
+
+// signResponse signs the given response as a server would, given the MAC of
+// the query and the time and error code to sign with.
+func signResponse(res []byte, reqMAC []byte, timeSigned uint64, errCode uint16) []byte {
+	rec := &tsigRecord{
+		name:       tsigTestKeyName,
+		algorithm:  HMACSHA256,
+		timeSigned: timeSigned,
+		fudge:      defaultTSIGFudge,
+		originalID: binary.BigEndian.Uint16(res[0:2]),
+		err:        errCode,
+	}
+
+	macSize := []byte{0, 0}
+	binary.BigEndian.PutUint16(macSize, uint16(len(reqMAC)))
+
+	m := hmac.New(sha256.New, []byte(tsigTestSecret))
+	m.Write(macSize)
+	m.Write(reqMAC)
+	m.Write(res)
+	m.Write(rec.variables())
+	rec.mac = m.Sum(nil)
+
+	b := bytes.NewBuffer(nil)
+	b.Write(res)
+	rec.write(b)
+	signed := b.Bytes()
+	binary.BigEndian.PutUint16(signed[10:12], binary.BigEndian.Uint16(signed[10:12])+1)
+	return signed
+}
+
+func TestTSIGSign(t *testing.T) {
+	defer setTSIGNow(tsigTestTime)()
+
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+	binary.BigEndian.PutUint16(q[0:2], 0x1234)
+
+	signed, mac, err := newTestTSIGConfig().sign(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(mac) != expectedTSIGMAC {
+		t.Fatalf("unexpected MAC %x", mac)
+	}
+
+	if binary.BigEndian.Uint16(signed[10:12]) != 1 {
+		t.Fail()
+	}
+
+	rec, start, err := findTSIG(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if start != len(q) ||
+		rec.name != tsigTestKeyName ||
+		rec.algorithm != HMACSHA256 ||
+		rec.timeSigned != tsigTestTime ||
+		rec.fudge != defaultTSIGFudge ||
+		rec.originalID != 0x1234 ||
+		!bytes.Equal(rec.mac, mac) {
+		t.Fail()
+	}
+}
+
+func TestTSIGUnsupportedAlgorithm(t *testing.T) {
+	c := newTestTSIGConfig()
+	c.Algorithm = "hmac-md5.sig-alg.reg.int"
+
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{})
+	if _, _, err := c.sign(q); err != ErrTSIGAlgorithm {
+		t.Fail()
+	}
+}
+
+func TestFindTSIGTruncated(t *testing.T) {
+	q := mustEncodeQuery("brendan.abolivier.bzh", A, IN, queryOptions{moreTypes: []DNSType{AAAA, MX}})
+	res := buildResponse(q)
+	// Claim a TSIG record, so that the questions must be skipped to look for
+	// it.
+	binary.BigEndian.PutUint16(res[10:12], 1)
+
+	// Truncating the response anywhere in its questions must fail instead of
+	// panicking.
+	for l := DNSMsgHeaderLen; l < len(res); l++ {
+		if _, _, err := findTSIG(res[:l]); err != ErrCorrupted {
+			t.Errorf("unexpected error %v for length %d", err, l)
+		}
+	}
+
+	// The root name followed by the end of the message.
+	res = append(res[:DNSMsgHeaderLen:DNSMsgHeaderLen], 0)
+	if _, _, err := findTSIG(res); err != ErrCorrupted {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestLookupTSIG(t *testing.T) {
+	defer setTSIGNow(tsigTestTime)()
+
+	tests := []struct {
+		name     string
+		sign     func(res []byte, reqMAC []byte) []byte
+		expected error
+	}{
+		{
+			name: "valid",
+			sign: func(res []byte, reqMAC []byte) []byte {
+				return signResponse(res, reqMAC, tsigTestTime, 0)
+			},
+		},
+		{
+			name:     "unsigned",
+			sign:     func(res []byte, _ []byte) []byte { return res },
+			expected: ErrTSIGUnsigned,
+		},
+		{
+			name: "tampered",
+			sign: func(res []byte, reqMAC []byte) []byte {
+				signed := signResponse(res, reqMAC, tsigTestTime, 0)
+				// Change the address in the answer.
+				signed[len(res)-1]++
+				return signed
+			},
+			expected: ErrTSIGBadSig,
+		},
+		{
+			name: "skewed",
+			sign: func(res []byte, reqMAC []byte) []byte {
+				return signResponse(res, reqMAC, tsigTestTime-3600, 0)
+			},
+			expected: ErrTSIGBadTime,
+		},
+		{
+			name: "bad key",
+			sign: func(res []byte, _ []byte) []byte {
+				return signResponse(res, nil, tsigTestTime, tsigBadKey)
+			},
+			expected: ErrTSIGBadKey,
+		},
+	}
+
+	for _, test := range tests {
+		r := newStubResolver(func(q []byte) []byte {
+			rec, start, err := findTSIG(q)
+			if err != nil {
+				t.Fatalf("%s: query isn't signed: %v", test.name, err)
+			}
+
+			res := buildResponse(q[:start], buildRR(A, 300, []byte{51, 38, 47, 191}))
+			binary.BigEndian.PutUint16(res[10:12], 0)
+			return test.sign(res, rec.mac)
+		})
+		r.TSIG = newTestTSIGConfig()
+
+		recs, _, err := r.LookupA("brendan.abolivier.bzh")
+		if err != test.expected {
+			t.Errorf("%s: expected error %v, got %v", test.name, test.expected, err)
+			continue
+		}
+
+		if test.expected == nil && (len(recs) != 1 || recs[0].IP4 != expectedA) {
+			t.Errorf("%s: unexpected records %v", test.name, recs)
+		}
+	}
+}
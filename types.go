@@ -1,7 +1,9 @@
 package doh
 
 import (
+	"encoding/hex"
 	"net"
+	"strconv"
 )
 
 // DNSType implements DNS values.
@@ -11,23 +13,95 @@ const (
 	// A implements the DNS A type.
 	A DNSType = 1
 	// NS implements the DNS NS type.
-	NS = 2
+	NS DNSType = 2
 	// CNAME implements the DNS CNAME type.
-	CNAME = 5
+	CNAME DNSType = 5
 	// SOA implements the DNS SOA type.
-	SOA = 6
+	SOA DNSType = 6
+	// MB implements the DNS MB type.
+	MB DNSType = 7
+	// MG implements the DNS MG type.
+	MG DNSType = 8
+	// MR implements the DNS MR type.
+	MR DNSType = 9
 	// PTR implements the DNS PTR type.
-	PTR = 12
+	PTR DNSType = 12
 	// MX implements the DNS MX type.
-	MX = 15
+	MX DNSType = 15
 	// TXT implements the DNS TXT type.
-	TXT = 16
+	TXT DNSType = 16
 	// AAAA implements the DNS AAAA type.
-	AAAA = 28
+	AAAA DNSType = 28
 	// SRV implements the DNS SRV type.
-	SRV = 33
+	SRV DNSType = 33
+	// NAPTR implements the DNS NAPTR type.
+	NAPTR DNSType = 35
+	// DNAME implements the DNS DNAME type.
+	DNAME DNSType = 39
+	// OPT implements the pseudo-type of OPT records, which carry EDNS data as
+	// described in section 6 of RFC 6891.
+	OPT DNSType = 41
+	// DS implements the DNS DS type.
+	DS DNSType = 43
+	// SSHFP implements the DNS SSHFP type.
+	SSHFP DNSType = 44
+	// RRSIG implements the DNS RRSIG type.
+	RRSIG DNSType = 46
+	// DNSKEY implements the DNS DNSKEY type.
+	DNSKEY DNSType = 48
+	// TLSA implements the DNS TLSA type.
+	TLSA DNSType = 52
+	// SVCB implements the DNS SVCB type.
+	SVCB DNSType = 64
+	// HTTPS implements the DNS HTTPS type.
+	HTTPS DNSType = 65
+	// SPF implements the DNS SPF type.
+	SPF DNSType = 99
+	// URI implements the DNS URI type.
+	URI DNSType = 256
+	// CAA implements the DNS CAA type.
+	CAA DNSType = 257
 )
 
+// typeNames maps the DNS types this package defines to their mnemonic.
+var typeNames = map[DNSType]string{
+	A:      "A",
+	NS:     "NS",
+	CNAME:  "CNAME",
+	SOA:    "SOA",
+	MB:     "MB",
+	MG:     "MG",
+	MR:     "MR",
+	PTR:    "PTR",
+	MX:     "MX",
+	TXT:    "TXT",
+	AAAA:   "AAAA",
+	SRV:    "SRV",
+	NAPTR:  "NAPTR",
+	DNAME:  "DNAME",
+	OPT:    "OPT",
+	DS:     "DS",
+	SSHFP:  "SSHFP",
+	RRSIG:  "RRSIG",
+	DNSKEY: "DNSKEY",
+	TLSA:   "TLSA",
+	SVCB:   "SVCB",
+	HTTPS:  "HTTPS",
+	SPF:    "SPF",
+	URI:    "URI",
+	CAA:    "CAA",
+}
+
+// String returns the mnemonic of the type, e.g. "MX", or "TYPE" followed by
+// the type's value if it isn't known, as described in section 5 of RFC 3597.
+func (t DNSType) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
 // DNSClass implements DNS classes.
 type DNSClass uint16
 
@@ -35,56 +109,310 @@ const (
 	// IN implement the DNS Internet class.
 	IN DNSClass = 1
 	// CS implements the DNS CSNET class.
-	CS = 2
+	CS DNSClass = 2
 	// CH implements the DNS CH class.
-	CH = 3
+	CH DNSClass = 3
 	// HS implements the DNS Hesiod class.
-	HS = 4
+	HS DNSClass = 4
 	// ANYCLASS implements the DNS * QCLASS.
-	ANYCLASS = 255
+	ANYCLASS DNSClass = 255
 )
 
+// classNames maps the DNS classes this package defines to their mnemonic.
+var classNames = map[DNSClass]string{
+	IN:       "IN",
+	CS:       "CS",
+	CH:       "CH",
+	HS:       "HS",
+	ANYCLASS: "ANY",
+}
+
+// String returns the mnemonic of the class, e.g. "IN", or "CLASS" followed by
+// the class' value if it isn't known, as described in section 5 of RFC 3597.
+func (c DNSClass) String() string {
+	if name, ok := classNames[c]; ok {
+		return name
+	}
+
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+// Record is a parsed DNS record, i.e. one of the *XRecord types of this
+// package, such as *ARecord or *MXRecord. It can only be implemented by the
+// types of this package.
+type Record interface {
+	// rrHeader returns the record's RRHeader, or nil if it doesn't have one.
+	rrHeader() *RRHeader
+}
+
+// RRHeader holds the information from the resource record a record was parsed
+// from which isn't specific to its type. It's embedded in every record type.
+type RRHeader struct {
+	// Owner is the name the record belongs to, which can differ from the
+	// name that was looked up, e.g. for records found at the end of a CNAME
+	// chain.
+	Owner string
+	// TTL is the record's TTL, i.e. the same value as the one returned for
+	// the record alongside it by lookups. For records answered from a cache,
+	// it's decreased by the time spent in the cache.
+	TTL uint32
+}
+
+// rrHeader returns the record's RRHeader, so it can be filled once the record
+// is parsed.
+func (h *RRHeader) rrHeader() *RRHeader {
+	return h
+}
+
+// rrHeader returns nil, since the owner and TTL of an OPT record don't
+// describe the record itself: the owner is always the root and the bits of
+// the TTL hold EDNS flags, as described in section 6.1.3 of RFC 6891.
+func (*OPTRecord) rrHeader() *RRHeader {
+	return nil
+}
+
 // ARecord implements the DNS A record.
 type ARecord struct {
+	RRHeader
 	IP4 string
+	// IP is the same address as IP4, as a net.IP.
+	IP net.IP
 }
 
 // AAAARecord implements the DNS AAAA record.
 type AAAARecord struct {
+	RRHeader
 	IP6 string
+	// IP is the same address as IP6, as a net.IP.
+	IP net.IP
 }
 
 // CNAMERecord implements the DNS CNAME record.
 type CNAMERecord struct {
+	RRHeader
 	CNAME string
 }
 
 // TXTRecord implements the DNS TXT record.
 type TXTRecord struct {
+	RRHeader
+	// TXT is the concatenation of the record's character-strings.
 	TXT string
+	// Strings holds each of the record's character-strings.
+	Strings []string
 }
 
 // SOARecord implements the DNS SOA record.
 type SOARecord struct {
+	RRHeader
 	PrimaryNS   string
 	RespMailbox string
 	Serial      uint32
-	Refresh     int32
-	Retry       int32
-	Expire      int32
+	Refresh     uint32
+	Retry       uint32
+	Expire      uint32
 	Minimum     uint32
 }
 
 // PTRRecord implements the DNS PTR record.
 type PTRRecord struct {
+	RRHeader
 	PTR string
 }
 
-// MXRecord implements the DNS MX record.
-type MXRecord net.MX
+// MBRecord implements the DNS MB record.
+type MBRecord struct {
+	RRHeader
+	Name string
+}
+
+// MGRecord implements the DNS MG record.
+type MGRecord struct {
+	RRHeader
+	Name string
+}
+
+// MRRecord implements the DNS MR record.
+type MRRecord struct {
+	RRHeader
+	Name string
+}
+
+// MXRecord implements the DNS MX record. Its fields are the same as the ones
+// of net.MX.
+type MXRecord struct {
+	RRHeader
+	Host string
+	Pref uint16
+}
 
-// SRVRecord implements the DNS SRV record.
-type SRVRecord net.SRV
+// SRVRecord implements the DNS SRV record. Its fields are the same as the ones
+// of net.SRV.
+type SRVRecord struct {
+	RRHeader
+	Target   string
+	Port     uint16
+	Priority uint16
+	Weight   uint16
+}
 
-// NSRecord implements the DNS NS record.
-type NSRecord net.NS
+// NSRecord implements the DNS NS record. Its fields are the same as the ones
+// of net.NS.
+type NSRecord struct {
+	RRHeader
+	Host string
+}
+
+// NAPTRRecord implements the DNS NAPTR record, as described in section 4.1 of
+// RFC 3403.
+type NAPTRRecord struct {
+	RRHeader
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// TLSARecord implements the DNS TLSA record, as described in section 2.1 of
+// RFC 6698.
+type TLSARecord struct {
+	RRHeader
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	// Certificate is the certificate association data, i.e. the full
+	// certificate or public key, or a hash of it, depending on the selector and
+	// matching type.
+	Certificate []byte
+}
+
+// SSHFPRecord implements the DNS SSHFP record, as described in section 3.1 of
+// RFC 4255.
+type SSHFPRecord struct {
+	RRHeader
+	Algorithm uint8
+	// Type is the type of the fingerprint, i.e. the algorithm used to compute
+	// it.
+	Type        uint8
+	Fingerprint []byte
+}
+
+// FingerprintHex returns the record's fingerprint as a lowercase hexadecimal
+// string, which is how tools such as ssh-keygen display it.
+func (s *SSHFPRecord) FingerprintHex() string {
+	return hex.EncodeToString(s.Fingerprint)
+}
+
+// DSRecord implements the DNS DS record, as described in section 5.1 of
+// RFC 4034.
+type DSRecord struct {
+	RRHeader
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// RRSIGRecord implements the DNS RRSIG record, as described in section 3.1 of
+// RFC 4034. Expiration and Inception are numbers of seconds since the Unix
+// epoch, modulo 2^32.
+type RRSIGRecord struct {
+	RRHeader
+	TypeCovered DNSType
+	Algorithm   uint8
+	// Labels is the number of labels of the owner name of the signed records,
+	// not counting any wildcard label.
+	Labels      uint8
+	OriginalTTL uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+// DNSKEYRecord implements the DNS DNSKEY record, as described in section 2.1 of
+// RFC 4034.
+type DNSKEYRecord struct {
+	RRHeader
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+// URIRecord implements the DNS URI record, as described in section 4.5 of
+// RFC 7553.
+type URIRecord struct {
+	RRHeader
+	Priority uint16
+	Weight   uint16
+	Target   string
+}
+
+// OPTRecord implements the OPT pseudo-record, which carries the EDNS data of a
+// message, as described in section 6.1 of RFC 6891.
+type OPTRecord struct {
+	// UDPSize is the UDP payload size advertised by the sender.
+	UDPSize uint16
+	// ExtendedRCode holds the upper 8 bits of the message's 12-bit response
+	// code.
+	ExtendedRCode uint8
+	Version       uint8
+	// DNSSECOK is the value of the DO bit, as described in section 3 of RFC
+	// 3225.
+	DNSSECOK bool
+	Options  []EDNSOption
+}
+
+// EDNSOption is an option of an OPT record, e.g. EDNS Client Subnet or Padding.
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+// DNAMERecord implements the DNS DNAME record, as described in section 2.1 of
+// RFC 6672.
+type DNAMERecord struct {
+	RRHeader
+	// Target is the name which the subtree under the record's owner is
+	// redirected to.
+	Target string
+}
+
+// SPFRecord implements the DNS SPF record, as described in section 3.1 of RFC
+// 4408. Its RDATA has the same format as the one of TXT records, and is
+// usually published in TXT records instead.
+type SPFRecord struct {
+	RRHeader
+	// SPF is the concatenation of the record's character-strings.
+	SPF string
+	// Strings holds each of the record's character-strings.
+	Strings []string
+}
+
+// SVCBRecord implements the DNS SVCB record.
+type SVCBRecord struct {
+	RRHeader
+	Priority uint16
+	Target   string
+	// Params maps the keys of the record's SvcParams (e.g. SVCBKeyALPN) to
+	// their value in wire format.
+	Params map[uint16][]byte
+}
+
+// HTTPSRecord implements the DNS HTTPS record, which has the same format as
+// the SVCB record.
+type HTTPSRecord struct {
+	SVCBRecord
+}
+
+// CAARecord implements the DNS CAA record.
+type CAARecord struct {
+	RRHeader
+	Flag  uint8
+	Tag   string
+	Value string
+}
@@ -0,0 +1,79 @@
+package doh
+
+import (
+	"testing"
+)
+
+func TestDNSTypeString(t *testing.T) {
+	tests := map[DNSType]string{
+		A:              "A",
+		AAAA:           "AAAA",
+		MX:             "MX",
+		HTTPS:          "HTTPS",
+		CAA:            "CAA",
+		DNSType(42):    "TYPE42",
+		DNSType(65280): "TYPE65280",
+	}
+
+	for rtype, expected := range tests {
+		if rtype.String() != expected {
+			t.Errorf("expected %s, got %s", expected, rtype.String())
+		}
+	}
+}
+
+func TestDNSClassString(t *testing.T) {
+	tests := map[DNSClass]string{
+		IN:           "IN",
+		CH:           "CH",
+		ANYCLASS:     "ANY",
+		DNSClass(12): "CLASS12",
+	}
+
+	for class, expected := range tests {
+		if class.String() != expected {
+			t.Errorf("expected %s, got %s", expected, class.String())
+		}
+	}
+}
+
+func TestConstantTypes(t *testing.T) {
+	// Untyped constants would default to int when stored in an interface.
+	for _, c := range []interface{}{
+		A, NS, CNAME, SOA, MB, MG, MR, PTR, MX, TXT, AAAA, SRV, NAPTR, DNAME,
+		OPT, DS, SSHFP, DNSKEY, TLSA, SVCB, HTTPS, SPF, URI, CAA,
+	} {
+		if _, ok := c.(DNSType); !ok {
+			t.Errorf("%v is a %T, not a DNSType", c, c)
+		}
+	}
+
+	for _, c := range []interface{}{IN, CS, CH, HS, ANYCLASS} {
+		if _, ok := c.(DNSClass); !ok {
+			t.Errorf("%v is a %T, not a DNSClass", c, c)
+		}
+	}
+}
+
+func TestRecordTypes(t *testing.T) {
+	// Every record type of this package must implement Record.
+	recs := []Record{
+		new(ARecord), new(AAAARecord), new(CNAMERecord), new(TXTRecord),
+		new(SOARecord), new(PTRRecord), new(MBRecord), new(MGRecord),
+		new(MRRecord), new(MXRecord), new(SRVRecord), new(NSRecord),
+		new(NAPTRRecord), new(TLSARecord), new(SSHFPRecord), new(DSRecord),
+		new(RRSIGRecord), new(DNSKEYRecord), new(URIRecord), new(DNAMERecord),
+		new(SPFRecord), new(SVCBRecord), new(HTTPSRecord), new(CAARecord),
+	}
+
+	for _, rec := range recs {
+		if h := rec.rrHeader(); h == nil {
+			t.Errorf("%T doesn't have a RRHeader", rec)
+		}
+	}
+
+	// OPT records don't have a RRHeader.
+	if h := new(OPTRecord).rrHeader(); h != nil {
+		t.Fail()
+	}
+}
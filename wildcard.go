@@ -0,0 +1,38 @@
+package doh
+
+import (
+	"strings"
+)
+
+// wildcard returns whether the message's answers look synthesized from a
+// wildcard, i.e. whether its answer section holds an RRSIG record which
+// Labels field is lower than the number of labels of its owner name, as
+// described in section 5.3.4 of RFC 4035.
+// The owner names of synthesized answers are the name that was looked up, so
+// they don't need any special handling otherwise.
+func (m *message) wildcard() bool {
+	for _, a := range m.answers {
+		if sig, ok := a.parsed.(*RRSIGRecord); ok && a.t == RRSIG && int(sig.Labels) < countLabels(a.name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countLabels returns the number of labels of the given name, not counting the
+// root label nor a leading wildcard label, the same way the Labels field of
+// RRSIG records does as described in section 3.1.3 of RFC 4034.
+func countLabels(name string) int {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return 0
+	}
+
+	labels := strings.Split(name, ".")
+	if labels[0] == "*" {
+		return len(labels) - 1
+	}
+
+	return len(labels)
+}
@@ -0,0 +1,71 @@
+package doh
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+)
+
+// newWildcardResolver returns a resolver answering A queries with an A record
+// signed by an RRSIG record with the given Labels field.
+func newWildcardResolver(t *testing.T, labels uint8) *Resolver {
+	sig, err := base64.RawStdEncoding.DecodeString(rdataRRSIG)
+	if err != nil {
+		t.FailNow()
+	}
+	sig[3] = labels
+
+	return newStubResolver(func(q []byte) []byte {
+		return buildResponse(q, buildRR(A, 300, []byte{51, 38, 47, 191}), buildRR(RRSIG, 300, sig))
+	})
+}
+
+func TestLookupWildcard(t *testing.T) {
+	// An answer synthesized from *.abolivier.bzh, which has 2 labels.
+	r := newWildcardResolver(t, 2)
+
+	recs, _, err := r.LookupA("brendan.abolivier.bzh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recs) != 1 || recs[0].IP4 != expectedA || recs[0].Owner != "brendan.abolivier.bzh" {
+		t.Fatalf("unexpected records %v", recs)
+	}
+
+	resp, err := r.LookupResponse(context.Background(), "brendan.abolivier.bzh", A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resp.Wildcard {
+		t.Error("expected the answers to be reported as synthesized")
+	}
+
+	// An answer for brendan.abolivier.bzh itself.
+	r = newWildcardResolver(t, 3)
+	resp, err = r.LookupResponse(context.Background(), "brendan.abolivier.bzh", A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Wildcard {
+		t.Error("expected the answers not to be reported as synthesized")
+	}
+}
+
+func TestCountLabels(t *testing.T) {
+	tests := map[string]int{
+		"":                       0,
+		"bzh":                    1,
+		"brendan.abolivier.bzh":  3,
+		"brendan.abolivier.bzh.": 3,
+		"*.abolivier.bzh":        2,
+	}
+
+	for name, expected := range tests {
+		if c := countLabels(name); c != expected {
+			t.Errorf("expected %d labels for %q, got %d", expected, name, c)
+		}
+	}
+}